@@ -0,0 +1,365 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"peerbase.net/go/bytesize"
+	"peerbase.net/go/semver"
+)
+
+var defaultBuiltins = NewBuiltins()
+
+// Builtin defines a function that can be called from EON in dynamic mode.
+//
+// The arguments to a call are checked against Params before Func is called, so
+// that Func can rely on getting the right number of arguments of the right
+// kinds. A zero Kind within Params accepts an argument of any kind. If Variadic
+// is set, the last parameter may be repeated any number of times, including
+// zero, as with variadic Go functions, and if there are no Params at all, any
+// number of arguments of any kind are accepted.
+//
+// The value returned by Func is converted into a Value. Supported types are
+// bool, string, []byte, the integer and float types, time.Duration,
+// bytesize.Value, semver.Version, Date, and time.Time, which is converted to a
+// timestamp, along with slices of, and maps with string keys of, any of these
+// types. A nil value is converted to null, and a *Value is returned as is.
+type Builtin struct {
+	Func     func(args []*Value) (interface{}, error)
+	Params   []Kind
+	Variadic bool
+}
+
+// Builtins is a registry of the functions that can be called from EON source
+// in dynamic mode, keyed by their name, e.g. days.since.
+//
+// Builtins should be registered before the registry is used to evaluate any
+// source, as it is not safe to register builtins concurrently with evaluation.
+type Builtins struct {
+	funcs map[string]*Builtin
+	now   func() time.Time
+}
+
+// Eval evaluates the EON-encoded data in dynamic mode, like the top-level Eval
+// function, but with calls being resolved against the builtins in the
+// registry.
+func (b *Builtins) Eval(data []byte) (*Value, error) {
+	return eval(data, b)
+}
+
+// Lookup returns the builtin with the given name, or nil if there isn't one.
+func (b *Builtins) Lookup(name string) *Builtin {
+	return b.funcs[name]
+}
+
+// Register adds a builtin with the given name to the registry, replacing any
+// existing builtin with the same name. Names are one or more identifiers
+// separated by dots, e.g. str.upper.
+func (b *Builtins) Register(name string, fn *Builtin) {
+	b.funcs[name] = fn
+}
+
+// Unregister removes the builtin with the given name from the registry.
+func (b *Builtins) Unregister(name string) {
+	delete(b.funcs, name)
+}
+
+// EnvBuiltin returns a builtin that returns the value of the environment
+// variable with the given name. It is an error for the variable to not be set.
+//
+// As it reads from the host environment, it is not registered by default, and
+// must be explicitly registered by hosts that want to provide it, e.g.
+//
+//	builtins.Register("env", eon.EnvBuiltin())
+func EnvBuiltin() *Builtin {
+	return &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			name := args[0].text
+			v, ok := os.LookupEnv(name)
+			if !ok {
+				return nil, fmt.Errorf("environment variable %s is not set", name)
+			}
+			return v, nil
+		},
+		Params: []Kind{KindString},
+	}
+}
+
+// NewBuiltins returns a registry with the default set of builtins, none of
+// which perform any I/O:
+//
+//	days.since date              the number of whole days since the date
+//	math.abs number              the absolute value
+//	math.ceil number             the least integer greater than or equal
+//	math.floor number            the greatest integer less than or equal
+//	math.max number...           the largest of one or more numbers
+//	math.min number...           the smallest of one or more numbers
+//	math.round number            the nearest integer, rounding half away
+//	                             from zero
+//	str.join list string         the text of the elements joined by the
+//	                             separator
+//	str.lower string             the string in lower case
+//	str.replace string old new   the string with all instances of old
+//	                             replaced by new
+//	str.split string separator   the list of substrings between separators
+//	str.trim string              the string without leading and trailing
+//	                             whitespace
+//	str.upper string             the string in upper case
+func NewBuiltins() *Builtins {
+	b := &Builtins{
+		funcs: map[string]*Builtin{},
+		now:   time.Now,
+	}
+	b.Register("days.since", &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			t, err := args[0].Time()
+			if err != nil {
+				return nil, err
+			}
+			return int64(b.now().Sub(t) / (24 * time.Hour)), nil
+		},
+		Params: []Kind{KindDate},
+	})
+	b.Register("math.abs", numberBuiltin(math.Abs, func(i int64) (int64, bool) {
+		if i == math.MinInt64 {
+			return 0, false
+		}
+		if i < 0 {
+			return -i, true
+		}
+		return i, true
+	}))
+	b.Register("math.ceil", numberBuiltin(math.Ceil, nil))
+	b.Register("math.floor", numberBuiltin(math.Floor, nil))
+	b.Register("math.max", &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			return extreme(args, 1)
+		},
+		Params:   []Kind{KindNumber, KindNumber},
+		Variadic: true,
+	})
+	b.Register("math.min", &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			return extreme(args, -1)
+		},
+		Params:   []Kind{KindNumber, KindNumber},
+		Variadic: true,
+	})
+	b.Register("math.round", numberBuiltin(math.Round, nil))
+	b.Register("str.join", &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			elems := make([]string, len(args[0].elems))
+			for i, elem := range args[0].elems {
+				s, err := elem.Text()
+				if err != nil {
+					return nil, err
+				}
+				elems[i] = s
+			}
+			return strings.Join(elems, args[1].text), nil
+		},
+		Params: []Kind{KindList, KindString},
+	})
+	b.Register("str.lower", stringBuiltin(strings.ToLower))
+	b.Register("str.replace", &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			return strings.Replace(args[0].text, args[1].text, args[2].text, -1), nil
+		},
+		Params: []Kind{KindString, KindString, KindString},
+	})
+	b.Register("str.split", &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			return strings.Split(args[0].text, args[1].text), nil
+		},
+		Params: []Kind{KindString, KindString},
+	})
+	b.Register("str.trim", stringBuiltin(strings.TrimSpace))
+	b.Register("str.upper", stringBuiltin(strings.ToUpper))
+	return b
+}
+
+// PrintBuiltin returns a builtin that writes the text of its arguments to the
+// given writer, separated by spaces and followed by a newline. It returns
+// null.
+//
+// As it performs I/O, it is not registered by default, and must be explicitly
+// registered by hosts that want to provide it, e.g.
+//
+//	builtins.Register("print", eon.PrintBuiltin(os.Stdout))
+func PrintBuiltin(w io.Writer) *Builtin {
+	return &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			parts := make([]string, len(args))
+			for i, arg := range args {
+				s, err := arg.Text()
+				if err != nil {
+					return nil, err
+				}
+				parts[i] = s
+			}
+			_, err := io.WriteString(w, strings.Join(parts, " ")+"\n")
+			return nil, err
+		},
+		Params:   []Kind{0},
+		Variadic: true,
+	}
+}
+
+// extreme returns the largest of the given numbers if sign is positive, or
+// the smallest otherwise.
+func extreme(args []*Value, sign float64) (*Value, error) {
+	var (
+		best  *Value
+		bestF float64
+	)
+	for _, arg := range args {
+		f, err := arg.Float()
+		if err != nil {
+			return nil, err
+		}
+		if best == nil || (f-bestF)*sign > 0 {
+			best, bestF = arg, f
+		}
+	}
+	return best, nil
+}
+
+// numberBuiltin returns a builtin that applies fn to a number. If intFn is not
+// nil, it is applied to integers instead, so that they don't lose precision.
+// Otherwise, integers are returned as is.
+func numberBuiltin(fn func(float64) float64, intFn func(int64) (int64, bool)) *Builtin {
+	return &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			if i, err := args[0].Int(); err == nil {
+				if intFn == nil {
+					return i, nil
+				}
+				if i, ok := intFn(i); ok {
+					return i, nil
+				}
+			}
+			f, err := args[0].Float()
+			if err != nil {
+				return nil, err
+			}
+			return fn(f), nil
+		},
+		Params: []Kind{KindNumber},
+	}
+}
+
+func stringBuiltin(fn func(string) string) *Builtin {
+	return &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			return fn(args[0].text), nil
+		},
+		Params: []Kind{KindString},
+	}
+}
+
+// valueOf converts the value returned by a builtin into a Value positioned at
+// the given call.
+func valueOf(v interface{}, call *node) (*Value, error) {
+	if v, ok := v.(*Value); ok {
+		if v == nil {
+			return &Value{col: call.col, kind: KindNull, line: call.line}, nil
+		}
+		return v, nil
+	}
+	val := &Value{
+		col:  call.col,
+		line: call.line,
+	}
+	switch v := v.(type) {
+	case nil:
+		val.kind = KindNull
+		return val, nil
+	case []byte:
+		val.kind = KindBinary
+		val.text = string(v)
+		return val, nil
+	case bytesize.Value:
+		val.kind = KindByteSize
+		val.text = v.String()
+		return val, nil
+	case Date:
+		val.kind = KindDate
+		val.text = v.String()
+		return val, nil
+	case time.Duration:
+		val.kind = KindDuration
+		val.text = v.String()
+		return val, nil
+	case semver.Version:
+		val.kind = KindVersion
+		val.text = v.String()
+		return val, nil
+	case time.Time:
+		val.kind = KindTimestamp
+		val.text = v.Format(time.RFC3339Nano)
+		return val, nil
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Bool:
+		val.kind = KindBool
+		val.text = strconv.FormatBool(rv.Bool())
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if math.IsInf(f, 0) || math.IsNaN(f) {
+			return nil, errors.New("cannot convert non-finite float value")
+		}
+		val.kind = KindNumber
+		val.text = strconv.FormatFloat(f, 'f', -1, rv.Type().Bits())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		val.kind = KindNumber
+		val.text = strconv.FormatInt(rv.Int(), 10)
+	case reflect.Map:
+		if rv.Type().Key().Kind() != reflect.String {
+			return nil, fmt.Errorf("cannot convert value of type %s", rv.Type())
+		}
+		val.kind = KindBlock
+		val.values = make(map[string]*Value, rv.Len())
+		for _, key := range rv.MapKeys() {
+			val.keys = append(val.keys, key.String())
+		}
+		sort.Strings(val.keys)
+		for _, key := range val.keys {
+			elem, err := valueOf(rv.MapIndex(reflect.ValueOf(key).Convert(rv.Type().Key())).Interface(), call)
+			if err != nil {
+				return nil, err
+			}
+			val.values[key] = elem
+		}
+	case reflect.Slice:
+		val.kind = KindList
+		val.elems = make([]*Value, rv.Len())
+		for i := range val.elems {
+			elem, err := valueOf(rv.Index(i).Interface(), call)
+			if err != nil {
+				return nil, err
+			}
+			val.elems[i] = elem
+		}
+	case reflect.String:
+		val.kind = KindString
+		val.text = rv.String()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		val.kind = KindNumber
+		val.text = strconv.FormatUint(rv.Uint(), 10)
+	default:
+		return nil, fmt.Errorf("cannot convert value of type %s", rv.Type())
+	}
+	return val, nil
+}
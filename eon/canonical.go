@@ -0,0 +1,211 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"peerbase.net/go/bytesize"
+	"peerbase.net/go/semver"
+)
+
+// writeCanonical writes the canonical encoding of the given value node, which
+// was parsed from src.
+func (m *mstate) writeCanonical(n *node, src string) error {
+	switch n.kind {
+	case nodeBinary:
+		encodeBinary(m, []byte(n.text), OptInline)
+	case nodeBlock:
+		if len(n.calls) > 0 {
+			return callError(n.calls[0])
+		}
+		m.WriteByte('{')
+		for i, e := range sortedEntries(n) {
+			if i > 0 {
+				m.WriteString(", ")
+			}
+			m.writeKey(e.key)
+			m.WriteString(" = ")
+			if err := m.writeCanonical(e.value, src); err != nil {
+				return err
+			}
+		}
+		m.WriteByte('}')
+	case nodeBool:
+		m.WriteString(n.text)
+	case nodeByteSize:
+		v, err := bytesize.Parse(n.text)
+		if err != nil {
+			return &SyntaxError{Col: n.col, Line: n.line, Msg: "invalid byte size " + n.text + ": value overflows uint64"}
+		}
+		m.WriteString(v.String())
+	case nodeDate:
+		m.WriteString(n.text)
+	case nodeDuration:
+		v, err := time.ParseDuration(n.text)
+		if err != nil {
+			return &SyntaxError{Col: n.col, Line: n.line, Msg: "invalid duration " + n.text + ": value overflows int64"}
+		}
+		m.WriteString(v.String())
+	case nodeList:
+		m.WriteByte('[')
+		for i, elem := range n.elems {
+			if i > 0 {
+				m.WriteByte(' ')
+			}
+			if err := m.writeCanonical(elem, src); err != nil {
+				return err
+			}
+		}
+		m.WriteByte(']')
+	case nodeNull:
+		m.WriteString("null")
+	case nodeNumber:
+		v, err := canonicalNumber(n)
+		if err != nil {
+			return err
+		}
+		m.WriteString(v)
+	case nodeString:
+		encodeString(m, reflect.ValueOf(n.text), OptInline)
+	case nodeTemplate:
+		m.WriteString(src[n.start:n.end])
+	case nodeTimestamp:
+		t, err := time.Parse(time.RFC3339Nano, n.text)
+		if err != nil {
+			return &SyntaxError{Col: n.col, Line: n.line, Msg: "invalid timestamp " + n.text}
+		}
+		m.WriteString(t.Format(time.RFC3339Nano))
+	case nodeVersion:
+		v, err := semver.Parse(n.text)
+		if err != nil {
+			return &SyntaxError{Col: n.col, Line: n.line, Msg: strings.TrimPrefix(err.Error(), "semver: ")}
+		}
+		m.WriteString(v.String())
+	default:
+		return &TypeError{
+			Col:  n.col,
+			Line: n.line,
+			Msg:  "cannot canonicalize " + n.describe(),
+		}
+	}
+	return nil
+}
+
+// Canonicalize returns the canonical encoding of the EON-encoded data, so that
+// documents which only differ in their layout, comments, key order, or the way
+// that their literals are written, all have the same encoding.
+//
+// In the canonical encoding, each top-level entry is written on a line of its
+// own as key = value, while nested blocks and lists are written inline, e.g.
+// {area = "London", tags = ["a" "b"]}. The entries of every block are sorted
+// by key in byte order, comments are dropped, and strings are always written
+// as quoted strings, escaped as by Marshal.
+//
+// Numbers are written in decimal without exponents, using the shortest form
+// that round-trips, e.g. 1.50 and 15e-1 both become 1.5, while integers are
+// kept exact. Durations and byte sizes are written as by Marshal, e.g. 90m
+// becomes 1h30m0s and 1024KB becomes 1MB. Binary literals are written in
+// base64, and timestamps without any trailing zeros in their fractional
+// seconds, and with a zero UTC offset written as Z.
+//
+// Template strings are kept as written, as their values can depend on the
+// context in which they are evaluated. Blocks with duplicate keys result in a
+// KeyErrors value, and call statements, which are only supported by Eval, in a
+// TypeError.
+func Canonicalize(data []byte) ([]byte, error) {
+	n, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	u := &ustate{src: string(data)}
+	u.checkDuplicates(n)
+	if err := u.finish(nil); err != nil {
+		return nil, err
+	}
+	m := newMstate(nil)
+	if n.kind == nodeBlock {
+		if len(n.calls) > 0 {
+			err = callError(n.calls[0])
+		}
+		for _, e := range sortedEntries(n) {
+			if err != nil {
+				break
+			}
+			m.writeKey(e.key)
+			m.WriteString(" = ")
+			if err = m.writeCanonical(e.value, u.src); err == nil {
+				m.WriteByte('\n')
+			}
+		}
+	} else if err = m.writeCanonical(n, u.src); err == nil {
+		m.WriteByte('\n')
+	}
+	if err != nil {
+		mstates.Put(m)
+		return nil, err
+	}
+	out := make([]byte, m.Len())
+	copy(out, m.Bytes())
+	mstates.Put(m)
+	return out, nil
+}
+
+// Hash returns the SHA-256 digest of the canonical encoding of the EON-encoded
+// data, so that documents with the same content have the same hash.
+func Hash(data []byte) ([sha256.Size]byte, error) {
+	out, err := Canonicalize(data)
+	if err != nil {
+		return [sha256.Size]byte{}, err
+	}
+	return sha256.Sum256(out), nil
+}
+
+func callError(n *node) error {
+	return &TypeError{
+		Col:  n.col,
+		Line: n.line,
+		Msg:  "cannot call " + n.text + " outside of dynamic mode",
+	}
+}
+
+// canonicalNumber returns the canonical form of a number literal. Integers are
+// kept exact, however large, while other numbers are formatted in the same
+// way as float64 values are by Marshal.
+func canonicalNumber(n *node) (string, error) {
+	if !strings.ContainsAny(n.text, ".eE") {
+		if i, ok := new(big.Int).SetString(n.text, 10); ok {
+			return i.String(), nil
+		}
+	}
+	f, err := strconv.ParseFloat(n.text, 64)
+	if err != nil {
+		return "", &SyntaxError{
+			Col:  n.col,
+			Line: n.line,
+			Msg:  fmt.Sprintf("invalid number %s", n.text),
+		}
+	}
+	if f == 0 {
+		// Normalize negative zero, so that -0.0 matches -0 and 0.
+		f = 0
+	}
+	return strconv.FormatFloat(f, 'f', -1, 64), nil
+}
+
+func sortedEntries(n *node) []*entry {
+	entries := make([]*entry, len(n.entries))
+	copy(entries, n.entries)
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	return entries
+}
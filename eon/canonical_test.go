@@ -0,0 +1,126 @@
+package eon
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCanonicalize(t *testing.T) {
+	type elem struct {
+		src    string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"", ""},
+		{"b = 2\na = 1", "a = 1\nb = 2\n"},
+		{"// header\nname = \"tav\" // trailing\n\nport    =   8080\n", "name = \"tav\"\nport = 8080\n"},
+		{"author {\n\tname = \"tav\"\n\taddictions = [\"Gauloises\", \"Nutella\"]\n}", "author = {addictions = [\"Gauloises\" \"Nutella\"], name = \"tav\"}\n"},
+		{"a = {z = {y = 1, x = 2}, w = []}", "a = {w = [], z = {x = 2, y = 1}}\n"},
+		{"a = 1.50\nb = 15e-1\nc = 1e21\nd = 007\ne = 123456789012345678901234567890\nf = -0.0", "a = 1.5\nb = 1.5\nc = 1000000000000000000000\nd = 7\ne = 123456789012345678901234567890\nf = 0\n"},
+		{"a = 90m\nb = 1024KB\nc = 0s", "a = 1h30m0s\nb = 1MB\nc = 0s\n"},
+		{"a = hex\"010203\"", "a = b64\"AQID\"\n"},
+		{"a = 2018-09-01T12:00:00.500+00:00\nb = 2018-09-01\nc = 1.4.2-beta.1", "a = 2018-09-01T12:00:00.5Z\nb = 2018-09-01\nc = 1.4.2-beta.1\n"},
+		{"a = \"\"\"\n\tline 1\n\tline 2\n\t\"\"\"", "a = \"line 1\\nline 2\"\n"},
+		{"\"key with spaces\" = true\nb = null", "b = null\n\"key with spaces\" = true\n"},
+		{"name = \"tav\"\nmsg = `hi ${ name }`", "msg = `hi ${ name }`\nname = \"tav\"\n"},
+		{"[3 2 1]", "[3 2 1]\n"},
+		{"true = 1\nnull {false = 2}", "\"null\" = {\"false\" = 2}\n\"true\" = 1\n"},
+	} {
+		out, err := Canonicalize([]byte(elem.src))
+		if err != nil {
+			t.Errorf("unexpected error when canonicalizing %q: %s", elem.src, err)
+			continue
+		}
+		if string(out) != elem.expect {
+			t.Errorf("mismatching canonical encoding of %q: expected %q, got %q", elem.src, elem.expect, out)
+			continue
+		}
+		again, err := Canonicalize(out)
+		if err != nil {
+			t.Errorf("unexpected error when canonicalizing %q: %s", out, err)
+			continue
+		}
+		if string(again) != string(out) {
+			t.Errorf("canonical encoding is not stable: expected %q, got %q", out, again)
+		}
+	}
+}
+
+func TestCanonicalizeErrors(t *testing.T) {
+	type elem struct {
+		src    string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"a = 1\nb = [1", "expected ']'"},
+		{"a = 1\na = 2", "eon: duplicate key a at line 2, col 1"},
+		{"a {\n\tb = 1\n\tb = 1\n}", "eon: duplicate key a.b at line 3, col 2"},
+		{"a = 1\nprint a", "cannot call print outside of dynamic mode at line 2, col 1"},
+		{"a = 99999999999PB", "invalid byte size 99999999999PB"},
+	} {
+		_, err := Canonicalize([]byte(elem.src))
+		if err == nil {
+			t.Errorf("failed to receive expected error when canonicalizing %q", elem.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), elem.expect) {
+			t.Errorf("mismatching error when canonicalizing %q: expected %q, got %q", elem.src, elem.expect, err)
+		}
+	}
+}
+
+func TestHash(t *testing.T) {
+	a, err := Hash([]byte("// config\nport = 8080\nname = \"node1\"\ntimeout = 90s\n"))
+	if err != nil {
+		t.Fatalf("unexpected error when hashing: %s", err)
+	}
+	b, err := Hash([]byte("name = \"node1\"\n\ttimeout = 1m30s\nport = 8080.0"))
+	if err != nil {
+		t.Fatalf("unexpected error when hashing: %s", err)
+	}
+	if a != b {
+		t.Errorf("mismatching hashes for equivalent documents: %x and %x", a, b)
+	}
+	c, err := Hash([]byte("name = \"node1\"\ntimeout = 1m30s\nport = 8081"))
+	if err != nil {
+		t.Fatalf("unexpected error when hashing: %s", err)
+	}
+	if a == c {
+		t.Errorf("expected different hashes for different documents")
+	}
+}
+
+func TestMarshalCanonical(t *testing.T) {
+	type peer struct {
+		Port    int
+		Addr    string
+		Timeout time.Duration
+		Weight  float64
+	}
+	v := struct {
+		Peers map[string]peer
+		Name  string `eon:",multiline"`
+	}{
+		Peers: map[string]peer{"b": {8080, "10.0.0.2", time.Minute, 0.5}, "a": {9090, "10.0.0.1", 0, 2}},
+		Name:  "node1",
+	}
+	out, err := (MarshalOptions{Canonical: true, Indent: "  "}).Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error when encoding canonically: %s", err)
+	}
+	expect := `name = "node1"
+peers = {a = {addr = "10.0.0.1", port = 9090, timeout = 0s, weight = 2}, b = {addr = "10.0.0.2", port = 8080, timeout = 1m0s, weight = 0.5}}
+`
+	if string(out) != expect {
+		t.Errorf("mismatching canonical encoding: expected %q, got %q", expect, out)
+	}
+	src := "peers {\n\tb {\n\t\tweight = 0.50\n\t\ttimeout = 60s\n\t\tport = 8080\n\t\taddr = \"10.0.0.2\"\n\t}\n\ta = {port = 9090, addr = \"10.0.0.1\", timeout = 0s, weight = 2.0}\n}\nname = \"node1\""
+	canon, err := Canonicalize([]byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error when canonicalizing: %s", err)
+	}
+	if string(canon) != string(out) {
+		t.Errorf("mismatching canonical encodings of source and value: %q and %q", canon, out)
+	}
+}
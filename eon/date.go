@@ -0,0 +1,54 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"fmt"
+	"time"
+)
+
+const dateLayout = "2006-01-02"
+
+// Date represents a calendar date without a time of day or timezone. It is
+// encoded as an unquoted date literal, e.g. 2018-09-01.
+type Date struct {
+	Year  int
+	Month time.Month
+	Day   int
+}
+
+// IsValid returns whether the date exists in the proleptic Gregorian calendar
+// and has a year that can be written as a date literal, i.e. from 0 to 9999.
+func (d Date) IsValid() bool {
+	if d.Year < 0 || d.Year > 9999 {
+		return false
+	}
+	return DateOf(d.Time(time.UTC)) == d
+}
+
+// String returns the date in the YYYY-MM-DD form of a date literal.
+func (d Date) String() string {
+	return fmt.Sprintf("%04d-%02d-%02d", d.Year, d.Month, d.Day)
+}
+
+// Time returns the time at midnight on the date in the given location.
+func (d Date) Time(loc *time.Location) time.Time {
+	return time.Date(d.Year, d.Month, d.Day, 0, 0, 0, 0, loc)
+}
+
+// DateOf returns the date on which the given time falls, within its location.
+func DateOf(t time.Time) Date {
+	year, month, day := t.Date()
+	return Date{year, month, day}
+}
+
+// ParseDate parses a date in the YYYY-MM-DD form of a date literal. It returns
+// an error if the date doesn't exist, e.g. 2018-02-30.
+func ParseDate(s string) (Date, error) {
+	t, err := time.Parse(dateLayout, s)
+	if err != nil {
+		return Date{}, fmt.Errorf("eon: invalid date %s: %s", s, describeTimeError(err))
+	}
+	return DateOf(t), nil
+}
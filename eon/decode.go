@@ -0,0 +1,731 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"encoding"
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"peerbase.net/go/bytesize"
+	"peerbase.net/go/semver"
+)
+
+var decoders sync.Map
+
+type arrayDecoder struct {
+	elem decoder
+	size int
+}
+
+func (d *arrayDecoder) decode(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeList {
+		return u.mismatch(n, rv.Type())
+	}
+	if len(n.elems) != d.size {
+		return u.errorf(n, rv.Type(), "cannot decode list of %d elements into value of type %s", len(n.elems), rv.Type())
+	}
+	for i, elem := range n.elems {
+		if err := u.decode(d.elem, elem, rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type decoder func(*ustate, *node, reflect.Value) error
+
+type fieldDecoder struct {
+	dec   decoder
+	index []int
+	name  string
+}
+
+type mapDecoder struct {
+	elem     decoder
+	textKeys bool
+}
+
+func (d *mapDecoder) decode(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeBlock {
+		return u.mismatch(n, rv.Type())
+	}
+	rt := rv.Type()
+	if rv.IsNil() {
+		rv.Set(reflect.MakeMapWithSize(rt, len(n.entries)))
+	}
+	kt := rt.Key()
+	et := rt.Elem()
+	for _, e := range n.entries {
+		elem := reflect.New(et).Elem()
+		if err := u.decodeEntry(d.elem, e, elem); err != nil {
+			return err
+		}
+		var key reflect.Value
+		if d.textKeys {
+			key = reflect.New(kt)
+			if err := key.Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(e.key)); err != nil {
+				return u.errorf(e.value, kt, "invalid key %q: %s", e.key, err)
+			}
+			key = key.Elem()
+		} else {
+			key = reflect.ValueOf(e.key).Convert(kt)
+		}
+		rv.SetMapIndex(key, elem)
+	}
+	return nil
+}
+
+type ptrDecoder struct {
+	elem decoder
+}
+
+func (d *ptrDecoder) decode(u *ustate, n *node, rv reflect.Value) error {
+	if rv.IsNil() {
+		rv.Set(reflect.New(rv.Type().Elem()))
+	}
+	return u.decode(d.elem, n, rv.Elem())
+}
+
+type sliceDecoder struct {
+	elem decoder
+}
+
+func (d *sliceDecoder) decode(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeList {
+		return u.mismatch(n, rv.Type())
+	}
+	size := len(n.elems)
+	slice := reflect.MakeSlice(rv.Type(), size, size)
+	for i, elem := range n.elems {
+		if err := u.decode(d.elem, elem, slice.Index(i)); err != nil {
+			return err
+		}
+	}
+	rv.Set(slice)
+	return nil
+}
+
+type structDecoder struct {
+	fields   map[string]*fieldDecoder
+	required []*fieldDecoder
+}
+
+func (d *structDecoder) decode(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeBlock {
+		return u.mismatch(n, rv.Type())
+	}
+	var found map[string]bool
+	if len(d.required) > 0 {
+		found = make(map[string]bool, len(n.entries))
+	}
+	for _, e := range n.entries {
+		f, ok := d.fields[e.key]
+		if !ok {
+			if u.noUnknown {
+				u.keyError(e.line, e.col, e.key, "unknown key")
+			}
+			continue
+		}
+		if found != nil {
+			found[e.key] = true
+		}
+		if err := u.decodeEntry(f.dec, e, fieldByIndexAlloc(rv, f.index)); err != nil {
+			return err
+		}
+	}
+	for _, f := range d.required {
+		if !found[f.name] {
+			u.keyError(n.line, n.col, f.name, "missing required key")
+		}
+	}
+	return nil
+}
+
+// ustate holds the state for a single call to Unmarshal.
+type ustate struct {
+	eval         *estate
+	noDuplicates bool
+	noUnknown    bool
+	path         []string
+	problems     KeyErrors
+	src          string
+}
+
+// checkDuplicates records a problem for every key within the blocks of the
+// given node that repeats an earlier key in the same block.
+func (u *ustate) checkDuplicates(n *node) {
+	switch n.kind {
+	case nodeBlock:
+		seen := make(map[string]bool, len(n.entries))
+		for _, e := range n.entries {
+			if seen[e.key] {
+				u.keyError(e.line, e.col, e.key, "duplicate key")
+			}
+			seen[e.key] = true
+			u.path = append(u.path, e.key)
+			u.checkDuplicates(e.value)
+			u.path = u.path[:len(u.path)-1]
+		}
+	case nodeList:
+		for _, elem := range n.elems {
+			u.checkDuplicates(elem)
+		}
+	}
+}
+
+func (u *ustate) decode(dec decoder, n *node, rv reflect.Value) error {
+	if n.kind == nodeNull {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	if n.kind == nodeBlock && len(n.calls) > 0 {
+		return u.errorf(n.calls[0], nil, "cannot call %s outside of dynamic mode", n.calls[0].text)
+	}
+	return dec(u, n, rv)
+}
+
+func (u *ustate) decodeEntry(dec decoder, e *entry, rv reflect.Value) error {
+	u.path = append(u.path, e.key)
+	err := u.decode(dec, e.value, rv)
+	u.path = u.path[:len(u.path)-1]
+	return err
+}
+
+// finish returns the given error from decoding, or if there wasn't one, the
+// problems with keys that were found along the way, if any.
+func (u *ustate) finish(err error) error {
+	if err != nil || len(u.problems) == 0 {
+		return err
+	}
+	sort.SliceStable(u.problems, func(i, j int) bool {
+		a, b := u.problems[i], u.problems[j]
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Col < b.Col
+	})
+	return u.problems
+}
+
+// errorf returns a TypeError for the given node and the Go type that it was
+// being decoded into, if any.
+func (u *ustate) errorf(n *node, rt reflect.Type, format string, args ...interface{}) error {
+	return &TypeError{
+		Col:  n.col,
+		Key:  strings.Join(u.path, "."),
+		Line: n.line,
+		Msg:  fmt.Sprintf(format, args...),
+		Type: rt,
+	}
+}
+
+// genericValue returns the value of a node as decoded into an empty interface
+// value, resolving any templates within it.
+func (u *ustate) genericValue(n *node) (interface{}, error) {
+	switch n.kind {
+	case nodeBinary:
+		return []byte(n.text), nil
+	case nodeBlock:
+		if len(n.calls) > 0 {
+			return nil, u.errorf(n.calls[0], nil, "cannot call %s outside of dynamic mode", n.calls[0].text)
+		}
+		v := make(map[string]interface{}, len(n.entries))
+		for _, e := range n.entries {
+			u.path = append(u.path, e.key)
+			elem, err := u.genericValue(e.value)
+			if err != nil {
+				return nil, err
+			}
+			u.path = u.path[:len(u.path)-1]
+			v[e.key] = elem
+		}
+		return v, nil
+	case nodeBool:
+		return n.text == "true", nil
+	case nodeList:
+		v := make([]interface{}, len(n.elems))
+		for i, elem := range n.elems {
+			ev, err := u.genericValue(elem)
+			if err != nil {
+				return nil, err
+			}
+			v[i] = ev
+		}
+		return v, nil
+	case nodeByteSize:
+		v, _ := bytesize.Parse(n.text)
+		return v, nil
+	case nodeDuration:
+		v, _ := time.ParseDuration(n.text)
+		return v, nil
+	case nodeNumber:
+		if v, err := strconv.ParseInt(n.text, 10, 64); err == nil {
+			return v, nil
+		}
+		v, _ := strconv.ParseFloat(n.text, 64)
+		return v, nil
+	case nodeDate, nodeString, nodeTimestamp, nodeVersion:
+		return n.text, nil
+	case nodeTemplate:
+		return u.str(n)
+	}
+	return nil, nil
+}
+
+// keyError records a problem with the given key, which is relative to the
+// current path.
+func (u *ustate) keyError(line int, col int, key string, reason string) {
+	if len(u.path) > 0 {
+		key = strings.Join(u.path, ".") + "." + key
+	}
+	u.problems = append(u.problems, &KeyError{
+		Col:    col,
+		Key:    key,
+		Line:   line,
+		Reason: reason,
+	})
+}
+
+func (u *ustate) mismatch(n *node, rt reflect.Type) error {
+	return u.errorf(n, rt, "cannot decode %s into value of type %s", n.describe(), rt)
+}
+
+// str returns the value of a string or template node. Templates are resolved
+// by the evaluator, so that they can reference other keys in the document.
+func (u *ustate) str(n *node) (string, error) {
+	switch n.kind {
+	case nodeString:
+		return n.text, nil
+	case nodeTemplate:
+		u.eval.path = append(u.eval.path[:0], u.path...)
+		return u.eval.template(n)
+	}
+	return "", u.errorf(n, nil, "cannot decode %s into a string value", n.describe())
+}
+
+func decodeBool(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeBool {
+		return u.mismatch(n, rv.Type())
+	}
+	rv.SetBool(n.text == "true")
+	return nil
+}
+
+func decodeByteArray(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeBinary {
+		return u.mismatch(n, rv.Type())
+	}
+	if len(n.text) != rv.Len() {
+		return u.errorf(n, rv.Type(), "cannot decode %d bytes into value of type %s", len(n.text), rv.Type())
+	}
+	reflect.Copy(rv, reflect.ValueOf([]byte(n.text)))
+	return nil
+}
+
+// decodeByteSize decodes a byte size literal, or an integer number of bytes.
+func decodeByteSize(u *ustate, n *node, rv reflect.Value) error {
+	switch n.kind {
+	case nodeByteSize:
+		v, err := bytesize.Parse(n.text)
+		if err != nil {
+			return u.errorf(n, rv.Type(), "invalid byte size %s: value overflows uint64", n.text)
+		}
+		rv.SetUint(uint64(v))
+	case nodeNumber:
+		v, err := strconv.ParseUint(n.text, 10, 64)
+		if err != nil {
+			return u.errorf(n, rv.Type(), "invalid %s value %s", rv.Type(), n.text)
+		}
+		rv.SetUint(v)
+	default:
+		return u.mismatch(n, rv.Type())
+	}
+	return nil
+}
+
+// decodeByteSlice decodes a binary literal into a byte slice. Strings are also
+// accepted, and are decoded as their raw bytes.
+func decodeByteSlice(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind == nodeBinary {
+		rv.SetBytes([]byte(n.text))
+		return nil
+	}
+	v, err := u.str(n)
+	if err != nil {
+		return err
+	}
+	rv.SetBytes([]byte(v))
+	return nil
+}
+
+func decodeDate(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeDate {
+		return u.mismatch(n, rv.Type())
+	}
+	v, err := ParseDate(n.text)
+	if err != nil {
+		return u.errorf(n, rv.Type(), "invalid date %s", n.text)
+	}
+	rv.Set(reflect.ValueOf(v))
+	return nil
+}
+
+// decodeDuration decodes a duration literal, or an integer number of
+// nanoseconds.
+func decodeDuration(u *ustate, n *node, rv reflect.Value) error {
+	switch n.kind {
+	case nodeDuration:
+		v, err := time.ParseDuration(n.text)
+		if err != nil {
+			return u.errorf(n, rv.Type(), "invalid duration %s: value overflows int64", n.text)
+		}
+		rv.SetInt(int64(v))
+	case nodeNumber:
+		v, err := strconv.ParseInt(n.text, 10, 64)
+		if err != nil {
+			return u.errorf(n, rv.Type(), "invalid %s value %s", rv.Type(), n.text)
+		}
+		rv.SetInt(v)
+	default:
+		return u.mismatch(n, rv.Type())
+	}
+	return nil
+}
+
+func decodeFloat(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeNumber {
+		return u.mismatch(n, rv.Type())
+	}
+	v, err := strconv.ParseFloat(n.text, rv.Type().Bits())
+	if err != nil {
+		return u.errorf(n, rv.Type(), "invalid %s value %s", rv.Type(), n.text)
+	}
+	rv.SetFloat(v)
+	return nil
+}
+
+func decodeInt(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeNumber {
+		return u.mismatch(n, rv.Type())
+	}
+	v, err := strconv.ParseInt(n.text, 10, rv.Type().Bits())
+	if err != nil {
+		return u.errorf(n, rv.Type(), "invalid %s value %s", rv.Type(), n.text)
+	}
+	rv.SetInt(v)
+	return nil
+}
+
+func decodeInterface(u *ustate, n *node, rv reflect.Value) error {
+	if rv.NumMethod() != 0 {
+		return u.mismatch(n, rv.Type())
+	}
+	v, err := u.genericValue(n)
+	if err != nil {
+		return err
+	}
+	if v == nil {
+		rv.Set(reflect.Zero(rv.Type()))
+		return nil
+	}
+	rv.Set(reflect.ValueOf(v))
+	return nil
+}
+
+func decodeString(u *ustate, n *node, rv reflect.Value) error {
+	v, err := u.str(n)
+	if err != nil {
+		return err
+	}
+	rv.SetString(v)
+	return nil
+}
+
+// decodeTextUnmarshaler decodes a string by passing it to the UnmarshalText
+// method of the value.
+func decodeTextUnmarshaler(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeString && n.kind != nodeTemplate {
+		return u.mismatch(n, rv.Type())
+	}
+	v, err := u.str(n)
+	if err != nil {
+		return err
+	}
+	if err := rv.Addr().Interface().(encoding.TextUnmarshaler).UnmarshalText([]byte(v)); err != nil {
+		return u.errorf(n, rv.Type(), "cannot decode %q into value of type %s: %s", v, rv.Type(), err)
+	}
+	return nil
+}
+
+// decodeTime decodes a timestamp, preserving its UTC offset, or a date, which
+// is decoded as midnight UTC on that day.
+func decodeTime(u *ustate, n *node, rv reflect.Value) error {
+	layout := time.RFC3339Nano
+	switch n.kind {
+	case nodeDate:
+		layout = dateLayout
+	case nodeTimestamp:
+	default:
+		return u.mismatch(n, rv.Type())
+	}
+	v, err := time.Parse(layout, n.text)
+	if err != nil {
+		return u.errorf(n, rv.Type(), "invalid %s", n.describe())
+	}
+	rv.Set(reflect.ValueOf(v))
+	return nil
+}
+
+func decodeUint(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeNumber {
+		return u.mismatch(n, rv.Type())
+	}
+	v, err := strconv.ParseUint(n.text, 10, rv.Type().Bits())
+	if err != nil {
+		return u.errorf(n, rv.Type(), "invalid %s value %s", rv.Type(), n.text)
+	}
+	rv.SetUint(v)
+	return nil
+}
+
+// decodeUnmarshaler passes the raw source text of a value to the UnmarshalEON
+// method of the target.
+func decodeUnmarshaler(u *ustate, n *node, rv reflect.Value) error {
+	raw := []byte(u.src[n.start:n.end])
+	if err := rv.Addr().Interface().(Unmarshaler).UnmarshalEON(raw); err != nil {
+		return u.errorf(n, rv.Type(), "error calling UnmarshalEON for type %s: %s", rv.Type(), err)
+	}
+	return nil
+}
+
+func decodeVersion(u *ustate, n *node, rv reflect.Value) error {
+	if n.kind != nodeVersion {
+		return u.mismatch(n, rv.Type())
+	}
+	v, err := semver.Parse(n.text)
+	if err != nil {
+		return u.errorf(n, rv.Type(), "invalid version %s", n.text)
+	}
+	rv.Set(reflect.ValueOf(v))
+	return nil
+}
+
+func getDecoder(rt reflect.Type) (decoder, error) {
+	if dec, ok := decoders.Load(rt); ok {
+		return dec.(decoder), nil
+	}
+	var (
+		dec decoder
+		err error
+		wg  sync.WaitGroup
+	)
+	wg.Add(1)
+	// Add a temporary handler to deal with recursive types.
+	actual, loaded := decoders.LoadOrStore(rt, decoder(func(u *ustate, n *node, rv reflect.Value) error {
+		wg.Wait()
+		if err != nil {
+			return err
+		}
+		return dec(u, n, rv)
+	}))
+	if loaded {
+		return actual.(decoder), nil
+	}
+	dec, err = typeDecoder(rt)
+	if err == nil {
+		decoders.Store(rt, dec)
+	}
+	wg.Done()
+	return dec, err
+}
+
+// isTextUnmarshaler returns whether values of the given type should be decoded
+// with the encoding.TextUnmarshaler interface, i.e. if a pointer to the type
+// implements the interface and the type has no native EON encoding.
+func isTextUnmarshaler(rt reflect.Type) bool {
+	switch rt.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		return false
+	}
+	if rt == timeType {
+		return false
+	}
+	return reflect.PtrTo(rt).Implements(textUnmarshalerType)
+}
+
+// isUnmarshaler returns whether values of the given type should be decoded with
+// the Unmarshaler interface, i.e. if a pointer to the type implements it.
+// Pointer and interface types are excluded, so that pointers are allocated
+// before their elements are decoded.
+func isUnmarshaler(rt reflect.Type) bool {
+	switch rt.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		return false
+	}
+	return reflect.PtrTo(rt).Implements(unmarshalerType)
+}
+
+func newArrayDecoder(rt reflect.Type) (decoder, error) {
+	elem, err := getDecoder(rt.Elem())
+	if err != nil {
+		return nil, err
+	}
+	return (&arrayDecoder{
+		elem: elem,
+		size: rt.Len(),
+	}).decode, nil
+}
+
+func newMapDecoder(rt reflect.Type) (decoder, error) {
+	kt := rt.Key()
+	textKeys := false
+	if kt.Kind() != reflect.String {
+		if !reflect.PtrTo(kt).Implements(textUnmarshalerType) {
+			return nil, fmt.Errorf("eon: unsupported map key type %s", kt)
+		}
+		textKeys = true
+	}
+	elem, err := getDecoder(rt.Elem())
+	if err != nil {
+		return nil, err
+	}
+	return (&mapDecoder{
+		elem:     elem,
+		textKeys: textKeys,
+	}).decode, nil
+}
+
+func newPtrDecoder(rt reflect.Type) (decoder, error) {
+	elem, err := getDecoder(rt.Elem())
+	if err != nil {
+		return nil, err
+	}
+	return (&ptrDecoder{
+		elem: elem,
+	}).decode, nil
+}
+
+func newSliceDecoder(rt reflect.Type) (decoder, error) {
+	elem, err := getDecoder(rt.Elem())
+	if err != nil {
+		return nil, err
+	}
+	return (&sliceDecoder{
+		elem: elem,
+	}).decode, nil
+}
+
+func newStructDecoder(rt reflect.Type) (decoder, error) {
+	var (
+		fields   = map[string]*fieldDecoder{}
+		required []*fieldDecoder
+	)
+	for _, f := range structFields(rt) {
+		dec, err := getDecoder(f.typ)
+		if err != nil {
+			return nil, err
+		}
+		fd := &fieldDecoder{
+			dec:   dec,
+			index: f.index,
+			name:  f.name,
+		}
+		fields[f.name] = fd
+		if f.required {
+			required = append(required, fd)
+		}
+	}
+	return (&structDecoder{
+		fields:   fields,
+		required: required,
+	}).decode, nil
+}
+
+func typeDecoder(rt reflect.Type) (decoder, error) {
+	if isUnmarshaler(rt) {
+		return decodeUnmarshaler, nil
+	}
+	if isTextUnmarshaler(rt) {
+		return decodeTextUnmarshaler, nil
+	}
+	kind := rt.Kind()
+	switch kind {
+	case reflect.Array:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			return decodeByteArray, nil
+		}
+		return newArrayDecoder(rt)
+	case reflect.Bool:
+		return decodeBool, nil
+	case reflect.Float32, reflect.Float64:
+		return decodeFloat, nil
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32:
+		return decodeInt, nil
+	case reflect.Int64:
+		if rt == durationType {
+			return decodeDuration, nil
+		}
+		return decodeInt, nil
+	case reflect.Interface:
+		return decodeInterface, nil
+	case reflect.Map:
+		return newMapDecoder(rt)
+	case reflect.Ptr:
+		return newPtrDecoder(rt)
+	case reflect.Slice:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			return decodeByteSlice, nil
+		}
+		return newSliceDecoder(rt)
+	case reflect.String:
+		return decodeString, nil
+	case reflect.Struct:
+		switch rt {
+		case dateType:
+			return decodeDate, nil
+		case timeType:
+			return decodeTime, nil
+		case versionType:
+			return decodeVersion, nil
+		}
+		return newStructDecoder(rt)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+		return decodeUint, nil
+	case reflect.Uint64:
+		if rt == bytesizeType {
+			return decodeByteSize, nil
+		}
+		return decodeUint, nil
+	}
+	return nil, fmt.Errorf("eon: could not create decoder for %s", rt)
+}
+
+func unmarshal(data []byte, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("eon: Unmarshal requires a non-nil pointer, got %v", reflect.TypeOf(v))
+	}
+	n, err := parse(data)
+	if err != nil {
+		return err
+	}
+	dec, err := getDecoder(rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	u := &ustate{
+		eval: &estate{
+			builtins: defaultBuiltins,
+			root:     n,
+		},
+		src: string(data),
+	}
+	return u.finish(u.decode(dec, n, rv.Elem()))
+}
@@ -0,0 +1,552 @@
+package eon
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"peerbase.net/go/bytesize"
+	"peerbase.net/go/semver"
+)
+
+type upperUnmarshaler string
+
+func (u *upperUnmarshaler) UnmarshalEON(data []byte) error {
+	if string(data) == `"fail"` {
+		return errors.New("cannot fail")
+	}
+	*u = upperUnmarshaler(strings.ToUpper(string(data)))
+	return nil
+}
+
+type testAuthor struct {
+	Addictions []string
+	Email      string
+	Location   testLocation
+	Name       string
+	NodeID     int    `eon:"id"`
+	Skipped    string `eon:"-"`
+}
+
+type testLocation struct {
+	Area    string
+	Country string
+}
+
+func TestDecodeBlock(t *testing.T) {
+	src := `// Leading comment.
+tav {
+	name = "tav"
+	email = "tav@espians.com"
+	id = 42
+	addictions = ["Gauloises", "Nutella"]
+	skipped = "ignored"
+	unknown = [1 2 {x = 1}]
+	location {
+		area = "London" // Trailing comment.
+		country = "GB"
+	}
+}
+`
+	var v map[string]testAuthor
+	if err := Unmarshal([]byte(src), &v); err != nil {
+		t.Fatalf("unexpected error when decoding block: %s", err)
+	}
+	expect := map[string]testAuthor{
+		"tav": {
+			Addictions: []string{"Gauloises", "Nutella"},
+			Email:      "tav@espians.com",
+			Location: testLocation{
+				Area:    "London",
+				Country: "GB",
+			},
+			Name:   "tav",
+			NodeID: 42,
+		},
+	}
+	if !reflect.DeepEqual(expect, v) {
+		t.Errorf("mismatching decoded value for block: expected %#v, got %#v", expect, v)
+	}
+}
+
+func TestDecodeDurationAndByteSize(t *testing.T) {
+	var v struct {
+		MaxSize    bytesize.Value
+		BufferSize bytesize.Value
+		Timeout    time.Duration
+		Interval   time.Duration
+		Backoff    *time.Duration
+	}
+	src := "max-size = 20GB\nbuffer-size = 4096\ntimeout = 5h27m0s\ninterval = 1500000000\nbackoff = -1.5s"
+	if err := Unmarshal([]byte(src), &v); err != nil {
+		t.Fatalf("unexpected error when decoding: %s", err)
+	}
+	if expect := bytesize.Value(20 * bytesize.GB); v.MaxSize != expect {
+		t.Errorf("mismatching value for max-size: expected %s, got %s", expect, v.MaxSize)
+	}
+	if expect := bytesize.Value(4 * bytesize.KB); v.BufferSize != expect {
+		t.Errorf("mismatching value for buffer-size: expected %s, got %s", expect, v.BufferSize)
+	}
+	if v.Timeout != 327*time.Minute {
+		t.Errorf("mismatching value for timeout: expected %s, got %s", 327*time.Minute, v.Timeout)
+	}
+	if v.Interval != 1500*time.Millisecond {
+		t.Errorf("mismatching value for interval: expected %s, got %s", 1500*time.Millisecond, v.Interval)
+	}
+	if v.Backoff == nil || *v.Backoff != -1500*time.Millisecond {
+		t.Errorf("mismatching value for backoff: got %v", v.Backoff)
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	type elem struct {
+		src    string
+		v      interface{}
+		expect string
+	}
+	for _, elem := range []elem{
+		{`"hello`, new(string), "line 1, col 7"},
+		{"a = 1\nb = \"x\"", new(map[string]int), "for key b at line 2, col 5"},
+		{`300`, new(int8), "invalid int8 value 300"},
+		{"a {\n\tb = 1\n", new(map[string]interface{}), "expected '}'"},
+		{`[1 2`, new([]int), "expected ']'"},
+		{`a = `, new(map[string]int), "expected value"},
+		{`"\q"`, new(string), "invalid escape sequence"},
+		{"`${name}`", new(string), "cannot resolve name at line 1, col 4"},
+		{"`${str.upper 1}`", new(string), "argument 1 to str.upper must be a string, got number at line 1, col 14"},
+		{"a = 1\nprint a", new(map[string]int), "cannot call print outside of dynamic mode at line 2, col 1"},
+		{"a {\n\tstr.upper \"x\"\n}", new(interface{}), "cannot call str.upper outside of dynamic mode for key a at line 2, col 2"},
+		{"a = [{b = 1; print b}]", new(interface{}), "cannot call print outside of dynamic mode for key a at line 1, col 14"},
+		{"a = \"\"\"\n\tx\ny\n\t\"\"\"", new(map[string]string), "line 3, col 1: line in multiline string is not indented"},
+		{`b64"AQI"`, new([]byte), "line 1, col 1: invalid b64 literal"},
+		{`hex"abc"`, new([]byte), "invalid hex literal: odd number of hex digits"},
+		{`b64"AQID"`, new(string), "cannot decode binary into a string value"},
+		{`2018-02-30`, new(Date), "line 1, col 1: invalid date 2018-02-30: day out of range"},
+		{`2018-13-01`, new(time.Time), "invalid date 2018-13-01: month out of range"},
+		{`2018-09-01T24:00:00Z`, new(time.Time), "invalid timestamp 2018-09-01T24:00:00Z: hour out of range"},
+		{`2018-09-01T12:00:00+01`, new(time.Time), "incomplete literal"},
+		{`2018-09-01T12:00:00Z`, new(Date), "cannot decode timestamp 2018-09-01T12:00:00Z into value of type eon.Date"},
+		{`"2018-09-01"`, new(time.Time), "cannot decode string into value of type time.Time"},
+		{`20XB`, new(bytesize.Value), `line 1, col 3: unknown unit "XB" in literal "20XB"`},
+		{`5h30min`, new(time.Duration), `line 1, col 5: unknown unit "min" in literal "5h30min"`},
+		{`1.5GB`, new(bytesize.Value), "unexpected character 'G' in literal"},
+		{`99999999999PB`, new(bytesize.Value), "invalid byte size 99999999999PB: value overflows uint64 at line 1, col 1"},
+		{`9999999999h`, new(time.Duration), "invalid duration 9999999999h: value overflows int64"},
+		{`-5`, new(bytesize.Value), "invalid bytesize.Value value -5"},
+		{`1.5`, new(time.Duration), "invalid time.Duration value 1.5"},
+		{`20GB`, new(time.Duration), "cannot decode byte size 20GB into value of type time.Duration"},
+		{`1.0.01`, new(semver.Version), `line 1, col 1: invalid version "1.0.01": leading zero in component "01"`},
+		{`1.0.0-beta..1`, new(semver.Version), "unexpected character '.' in literal"},
+		{`"1.0.0"`, new(semver.Version), "cannot decode string into value of type semver.Version"},
+		{`[1 2 3]`, new([2]int), "cannot decode list of 3 elements into value of type [2]int"},
+		{`[1]`, new([2]int), "cannot decode list of 1 elements into value of type [2]int"},
+		{`b64"AQID"`, new([4]byte), "cannot decode 3 bytes into value of type [4]uint8"},
+		{`[1 2]`, new([2]byte), "cannot decode list into value of type [2]uint8"},
+		{`5`, nil, "non-nil pointer, got <nil>"},
+		{`5`, 5, "non-nil pointer, got int"},
+		{`5`, new(complex64), "could not create decoder"},
+	} {
+		err := Unmarshal([]byte(elem.src), elem.v)
+		if err == nil {
+			t.Errorf("failed to receive expected error when decoding %q", elem.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), elem.expect) {
+			t.Errorf("mismatching error when decoding %q: expected %q, got %q", elem.src, elem.expect, err)
+		}
+	}
+}
+
+func TestDecodeInterface(t *testing.T) {
+	var v interface{}
+	if err := Unmarshal([]byte("a = 1\nb = [true 2.5 \"x\" null]\nc {}"), &v); err != nil {
+		t.Fatalf("unexpected error when decoding into interface: %s", err)
+	}
+	expect := map[string]interface{}{
+		"a": int64(1),
+		"b": []interface{}{true, 2.5, "x", nil},
+		"c": map[string]interface{}{},
+	}
+	if !reflect.DeepEqual(expect, v) {
+		t.Errorf("mismatching decoded value for interface: expected %#v, got %#v", expect, v)
+	}
+	// Keywords are keys when they're followed by = or {.
+	if err := Unmarshal([]byte("null = 2\ntrue {\n\tfalse = 1\n}"), &v); err != nil {
+		t.Fatalf("unexpected error when decoding keyword keys: %s", err)
+	}
+	expect = map[string]interface{}{
+		"null": int64(2),
+		"true": map[string]interface{}{"false": int64(1)},
+	}
+	if !reflect.DeepEqual(expect, v) {
+		t.Errorf("mismatching decoded value for keyword keys: expected %#v, got %#v", expect, v)
+	}
+}
+
+func TestDecodeNull(t *testing.T) {
+	type config struct {
+		Name  *string
+		Peers []string
+	}
+	name := "tav"
+	v := config{Name: &name, Peers: []string{"a"}}
+	if err := Unmarshal([]byte("name = null\npeers = null"), &v); err != nil {
+		t.Fatalf("unexpected error when decoding null: %s", err)
+	}
+	if v.Name != nil || v.Peers != nil {
+		t.Errorf("failed to reset values when decoding null: got %#v", v)
+	}
+}
+
+func TestDecodePointer(t *testing.T) {
+	type config struct {
+		Name *string
+	}
+	var v *config
+	if err := Unmarshal([]byte(`name = "tav"`), &v); err != nil {
+		t.Fatalf("unexpected error when decoding pointer: %s", err)
+	}
+	if v == nil || v.Name == nil || *v.Name != "tav" {
+		t.Errorf("mismatching decoded value for pointer: got %#v", v)
+	}
+	type peer struct {
+		Name string
+		Next *peer
+	}
+	var p peer
+	if err := Unmarshal([]byte("name = \"a\"\nnext {\n\tname = \"b\"\n}"), &p); err != nil {
+		t.Fatalf("unexpected error when decoding recursive type: %s", err)
+	}
+	if p.Next == nil || p.Next.Name != "b" || p.Next.Next != nil {
+		t.Errorf("mismatching decoded value for recursive type: got %#v", p)
+	}
+}
+
+func TestDecodeRawValue(t *testing.T) {
+	src := `name = "node1"
+plugin {
+	kind = "metrics" // the plugin type
+	interval = 10s
+	tags = ["a", "b"]
+}
+port = 8080
+extra = null`
+	var v struct {
+		Name   string
+		Plugin RawValue
+		Port   RawValue
+		Extra  RawValue
+	}
+	if err := Unmarshal([]byte(src), &v); err != nil {
+		t.Fatalf("unexpected error when decoding raw values: %s", err)
+	}
+	expect := "{\n\tkind = \"metrics\" // the plugin type\n\tinterval = 10s\n\ttags = [\"a\", \"b\"]\n}"
+	if string(v.Plugin) != expect {
+		t.Errorf("mismatching raw value for plugin: expected %q, got %q", expect, v.Plugin)
+	}
+	if string(v.Port) != "8080" {
+		t.Errorf("mismatching raw value for port: expected %q, got %q", "8080", v.Port)
+	}
+	if v.Extra != nil {
+		t.Errorf("expected nil raw value for null, got %q", v.Extra)
+	}
+	var plugin struct {
+		Kind     string
+		Interval time.Duration
+		Tags     []string
+	}
+	if err := Unmarshal(v.Plugin, &plugin); err != nil {
+		t.Fatalf("unexpected error when decoding raw plugin value: %s", err)
+	}
+	if plugin.Kind != "metrics" || plugin.Interval != 10*time.Second || len(plugin.Tags) != 2 {
+		t.Errorf("mismatching decoded plugin value: %+v", plugin)
+	}
+	out, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error when encoding raw values: %s", err)
+	}
+	expectOut := "name = \"node1\"\nplugin = " + expect + "\nport = 8080\nextra = null"
+	if string(out) != expectOut {
+		t.Errorf("mismatching encoded raw values: expected %q, got %q", expectOut, out)
+	}
+	var whole RawValue
+	if err := Unmarshal([]byte(src), &whole); err != nil {
+		t.Fatalf("unexpected error when decoding top-level raw value: %s", err)
+	}
+	if string(whole) != src {
+		t.Errorf("mismatching top-level raw value: expected %q, got %q", src, whole)
+	}
+}
+
+func TestDecodeRequired(t *testing.T) {
+	type peer struct {
+		Addr string `eon:",required"`
+		Port int    `eon:"port,required"`
+	}
+	var v struct {
+		Name  string `eon:",required"`
+		Peers []peer
+	}
+	src := `peers = [
+	{addr = "10.0.0.1", port = 8080}
+	{port = null}
+	{}
+]`
+	err := Unmarshal([]byte(src), &v)
+	errs, ok := err.(KeyErrors)
+	if !ok {
+		t.Fatalf("expected KeyErrors when decoding missing required keys, got %v", err)
+	}
+	expect := []string{
+		"eon: missing required key name at line 1, col 1",
+		"eon: missing required key peers.addr at line 3, col 2",
+		"eon: missing required key peers.addr at line 4, col 2",
+		"eon: missing required key peers.port at line 4, col 2",
+	}
+	if len(errs) != len(expect) {
+		t.Fatalf("mismatching number of key errors: expected %d, got %d: %v", len(expect), len(errs), errs)
+	}
+	for i, want := range expect {
+		if errs[i].Error() != want {
+			t.Errorf("mismatching key error: expected %q, got %q", want, errs[i])
+		}
+	}
+	if err.Error() != expect[0]+" (and 3 more errors)" {
+		t.Errorf("mismatching error for key errors: got %q", err)
+	}
+	if v.Peers[0].Addr != "10.0.0.1" {
+		t.Errorf("expected the rest of the value to be decoded, got %+v", v.Peers)
+	}
+	if err := Unmarshal([]byte(`name = "tav"`), &v); err != nil {
+		t.Errorf("unexpected error when decoding required keys: %s", err)
+	}
+}
+
+func TestDecodeString(t *testing.T) {
+	type elem struct {
+		src    string
+		expect string
+	}
+	for _, elem := range []elem{
+		{`"hello"`, "hello"},
+		{`"\x00\t\r\"\\"`, "\x00\t\r\"\\"},
+		{`"line\nbreak"`, "line\nbreak"},
+		{`"héllo \U0001F600"`, "héllo 😀"},
+		{"`plain \\`template\\` \\${x}`", "plain `template` ${x}"},
+	} {
+		var v string
+		if err := Unmarshal([]byte(elem.src), &v); err != nil {
+			t.Errorf("unexpected error when decoding string %s: %s", elem.src, err)
+			continue
+		}
+		if elem.expect != v {
+			t.Errorf("mismatching decoded value for string: expected %q, got %q", elem.expect, v)
+		}
+	}
+}
+
+func TestDecodeTemplate(t *testing.T) {
+	src := "tav {\n" +
+		"\tname = \"tav\"\n" +
+		"\temail = `${name}@${domain}`\n" +
+		"\tlocation {\n" +
+		"\t\tarea = `${city}`\n" +
+		"\t}\n" +
+		"}\n" +
+		"domain = \"espians.com\"\n" +
+		"city = \"London\"\n"
+	var v struct {
+		Tav testAuthor
+	}
+	if err := Unmarshal([]byte(src), &v); err != nil {
+		t.Fatalf("unexpected error when decoding templates: %s", err)
+	}
+	if email := v.Tav.Email; email != "tav@espians.com" {
+		t.Errorf("mismatching decoded value for email: expected %q, got %q", "tav@espians.com", email)
+	}
+	if area := v.Tav.Location.Area; area != "London" {
+		t.Errorf("mismatching decoded value for area: expected %q, got %q", "London", area)
+	}
+	err := Unmarshal([]byte("tav {\n\temail = `${email}`\n}"), &v)
+	if err == nil || !strings.Contains(err.Error(), "reference cycle detected: tav.email -> email for key tav.email") {
+		t.Errorf("mismatching error when decoding a reference cycle: got %v", err)
+	}
+	var generic interface{}
+	if err := Unmarshal([]byte("a = \"x\"\nb = `hi ${a}`"), &generic); err != nil {
+		t.Fatalf("unexpected error when decoding template into interface value: %s", err)
+	}
+	if b := generic.(map[string]interface{})["b"]; b != "hi x" {
+		t.Errorf("mismatching decoded value for template in interface value: expected %q, got %q", "hi x", b)
+	}
+	var m map[string]interface{}
+	if err := Unmarshal([]byte(src), &m); err != nil {
+		t.Fatalf("unexpected error when decoding templates into map: %s", err)
+	}
+	tav := m["tav"].(map[string]interface{})
+	if email := tav["email"]; email != "tav@espians.com" {
+		t.Errorf("mismatching decoded value for email in map: expected %q, got %q", "tav@espians.com", email)
+	}
+	if area := tav["location"].(map[string]interface{})["area"]; area != "London" {
+		t.Errorf("mismatching decoded value for area in map: expected %q, got %q", "London", area)
+	}
+	err = Unmarshal([]byte("y {\n\tz = `${y}`\n}"), &generic)
+	if err == nil || !strings.Contains(err.Error(), "reference cycle detected: y.z -> y for key y.z") {
+		t.Errorf("mismatching error when decoding a reference cycle into interface value: got %v", err)
+	}
+}
+
+func TestDecodeTextUnmarshaler(t *testing.T) {
+	var v struct {
+		ID    testKey
+		Addr  net.IP
+		Stake *big.Int
+		Keys  []testKey
+		Host  testKey
+	}
+	src := "id = \"node:1\"\naddr = \"10.0.0.1\"\nstake = \"1208925819614629174706176\"\nkeys = [\"a:b\"]\nhost = `${id}`"
+	if err := Unmarshal([]byte(src), &v); err != nil {
+		t.Fatalf("unexpected error when decoding text unmarshalers: %s", err)
+	}
+	if expect := (testKey{"node", "1"}); v.ID != expect || v.Host != expect {
+		t.Errorf("mismatching decoded keys: expected %v, got %v and %v", expect, v.ID, v.Host)
+	}
+	if !v.Addr.Equal(net.IPv4(10, 0, 0, 1)) {
+		t.Errorf("mismatching decoded IP address: got %s", v.Addr)
+	}
+	if expect := new(big.Int).Lsh(big.NewInt(1), 80); v.Stake == nil || v.Stake.Cmp(expect) != 0 {
+		t.Errorf("mismatching decoded big int: expected %s, got %s", expect, v.Stake)
+	}
+	if len(v.Keys) != 1 || v.Keys[0] != (testKey{"a", "b"}) {
+		t.Errorf("mismatching decoded key list: got %v", v.Keys)
+	}
+	type elem struct {
+		src    string
+		expect string
+	}
+	for _, elem := range []elem{
+		{`id = "node"`, `cannot decode "node" into value of type eon.testKey: invalid test key "node" for key id at line 1, col 6`},
+		{`addr = "10.0.0.256"`, `cannot decode "10.0.0.256" into value of type net.IP: invalid IP address: 10.0.0.256 for key addr`},
+		{`stake = 100`, "cannot decode number 100 into value of type big.Int for key stake"},
+	} {
+		err := Unmarshal([]byte(elem.src), &v)
+		if err == nil || !strings.Contains(err.Error(), elem.expect) {
+			t.Errorf("mismatching error when decoding %q: expected %q, got %v", elem.src, elem.expect, err)
+		}
+	}
+}
+
+func TestDecodeTime(t *testing.T) {
+	type elem struct {
+		src    string
+		expect time.Time
+		offset int
+	}
+	for _, elem := range []elem{
+		{"2018-09-01", time.Date(2018, 9, 1, 0, 0, 0, 0, time.UTC), 0},
+		{"2018-09-01T12:30:00Z", time.Date(2018, 9, 1, 12, 30, 0, 0, time.UTC), 0},
+		{"2018-09-01T12:30:00.5+01:00", time.Date(2018, 9, 1, 11, 30, 0, 500000000, time.UTC), 3600},
+		{"2018-09-01T00:00:00-02:30", time.Date(2018, 9, 1, 2, 30, 0, 0, time.UTC), -9000},
+	} {
+		var v time.Time
+		if err := Unmarshal([]byte(elem.src), &v); err != nil {
+			t.Errorf("unexpected error when decoding %q: %s", elem.src, err)
+			continue
+		}
+		if !v.Equal(elem.expect) {
+			t.Errorf("mismatching decoded value for %q: expected %s, got %s", elem.src, elem.expect, v)
+		}
+		if _, offset := v.Zone(); offset != elem.offset {
+			t.Errorf("mismatching UTC offset for %q: expected %d, got %d", elem.src, elem.offset, offset)
+		}
+	}
+	var d Date
+	if err := Unmarshal([]byte("2020-02-29"), &d); err != nil {
+		t.Fatalf("unexpected error when decoding date: %s", err)
+	}
+	if expect := (Date{2020, time.February, 29}); d != expect {
+		t.Errorf("mismatching decoded date: expected %v, got %v", expect, d)
+	}
+}
+
+func TestDecodeUnmarshaler(t *testing.T) {
+	var v struct {
+		Upper  upperUnmarshaler
+		Ptr    *upperUnmarshaler
+		Values []upperUnmarshaler
+	}
+	src := "upper = \"a\"\nptr = [1 2]\nvalues = [1.5s {y = 1}]"
+	if err := Unmarshal([]byte(src), &v); err != nil {
+		t.Fatalf("unexpected error when decoding unmarshalers: %s", err)
+	}
+	if v.Upper != `"A"` {
+		t.Errorf("mismatching value for upper: expected %q, got %q", `"A"`, v.Upper)
+	}
+	if v.Ptr == nil || *v.Ptr != "[1 2]" {
+		t.Errorf("mismatching value for ptr: got %v", v.Ptr)
+	}
+	if len(v.Values) != 2 || v.Values[0] != "1.5S" || v.Values[1] != "{Y = 1}" {
+		t.Errorf("mismatching value for values: got %q", v.Values)
+	}
+	err := Unmarshal([]byte("upper = \"fail\""), &v)
+	if err == nil || !strings.Contains(err.Error(), "error calling UnmarshalEON for type eon.upperUnmarshaler: cannot fail for key upper at line 1, col 9") {
+		t.Errorf("mismatching error when decoding failing unmarshaler: got %v", err)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	for _, v := range []interface{}{
+		true,
+		false,
+		bytesize.KB,
+		327029 * bytesize.Byte,
+		327 * bytesize.GB,
+		time.Second,
+		100 * time.Nanosecond,
+		327 * time.Minute,
+		1024 * time.Millisecond,
+		Date{2018, time.September, 1},
+		time.Date(2018, 9, 1, 12, 30, 0, 123456789, time.UTC),
+		semver.MustParse("1.4.2-beta.1+build.7"),
+		float32(1e20),
+		float32(1e-7),
+		float32(1.538237820e+22),
+		1e20,
+		1e-7,
+		1.538237820e+22,
+		999999999999999868928.0,
+		math.MaxFloat64,
+		0,
+		-128,
+		9223372036854775807,
+		-9223372036854775808,
+		int8(-128),
+		int16(32767),
+		int32(-2147483648),
+		int64(-75927941794),
+		uint32(2147483647),
+		uint64(9223372036854775807),
+		[]int{1, 2, 3},
+		"hello world",
+		"\x00\t\r\"",
+		"héllo � world",
+	} {
+		out, err := Marshal(v)
+		if err != nil {
+			t.Errorf("unexpected error when encoding %#v: %s", v, err)
+			continue
+		}
+		rv := reflect.New(reflect.TypeOf(v))
+		if err := Unmarshal(out, rv.Interface()); err != nil {
+			t.Errorf("unexpected error when decoding %q into %T: %s", out, v, err)
+			continue
+		}
+		if got := rv.Elem().Interface(); !reflect.DeepEqual(v, got) {
+			t.Errorf("mismatching round-tripped value for %T: expected %#v, got %#v", v, v, got)
+		}
+	}
+}
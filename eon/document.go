@@ -0,0 +1,366 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Document represents a parsed EON document that can be edited in place. Edits
+// only rewrite the source of the entries that they touch, so that comments,
+// whitespace, and the order of keys are preserved everywhere else.
+//
+// Entries are addressed by the dotted path to their key, e.g. author.name. If
+// a block has multiple entries with the same key, the last one is used, as it
+// is the one that takes effect when decoding.
+type Document struct {
+	root *node
+	src  string
+}
+
+// Bytes returns the current source of the document.
+func (d *Document) Bytes() []byte {
+	return []byte(d.src)
+}
+
+// Delete removes the entry at the given path. If the entry is on a line of its
+// own, the whole line is removed, along with any comment lines directly above
+// it. Deleting a path that doesn't exist is not an error.
+func (d *Document) Delete(path string) error {
+	keys, err := splitPath(path)
+	if err != nil {
+		return err
+	}
+	parent, err := d.parent(keys)
+	if parent == nil {
+		return err
+	}
+	key := keys[len(keys)-1]
+	// Remove the entries in reverse order, so that the offsets of earlier
+	// entries remain valid.
+	src := d.src
+	for i := len(parent.entries) - 1; i >= 0; i-- {
+		if e := parent.entries[i]; e.key == key {
+			start, end := d.entrySpan(e)
+			src = src[:start] + src[end:]
+		}
+	}
+	return d.reparse(src)
+}
+
+// Get decodes the value at the given path into the value pointed to by v,
+// following the same rules as Unmarshal. The empty path refers to the whole
+// document.
+func (d *Document) Get(path string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("eon: Document.Get requires a non-nil pointer, got %v", reflect.TypeOf(v))
+	}
+	var keys []string
+	if path != "" {
+		var err error
+		if keys, err = splitPath(path); err != nil {
+			return err
+		}
+	}
+	n := d.lookup(keys)
+	if n == nil {
+		return fmt.Errorf("eon: could not find key %s", path)
+	}
+	dec, err := getDecoder(rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	u := &ustate{
+		eval: &estate{
+			builtins: defaultBuiltins,
+			root:     d.root,
+		},
+		path: keys,
+		src:  d.src,
+	}
+	return u.finish(u.decode(dec, n, rv.Elem()))
+}
+
+// Has returns whether the document has an entry at the given path.
+func (d *Document) Has(path string) bool {
+	keys, err := splitPath(path)
+	if err != nil {
+		return false
+	}
+	return d.lookup(keys) != nil
+}
+
+// Set sets the entry at the given path to the encoding of v. If the entry
+// already exists, only its value is rewritten. Otherwise, a new entry is added
+// after the last entry of the enclosing block, creating any missing blocks
+// along the way.
+func (d *Document) Set(path string, v interface{}) error {
+	keys, err := splitPath(path)
+	if err != nil {
+		return err
+	}
+	parent := d.root
+	if parent.kind != nodeBlock {
+		return errors.New("eon: cannot set keys in a document that is not a block")
+	}
+	for i, key := range keys {
+		e := lastEntry(parent, key)
+		if e == nil {
+			// Wrap the value in a block for each of the remaining keys.
+			for j := len(keys) - 1; j > i; j-- {
+				v = map[string]interface{}{keys[j]: v}
+			}
+			return d.insert(parent, key, v)
+		}
+		if i == len(keys)-1 {
+			return d.replace(e, v)
+		}
+		if e.value.kind != nodeBlock {
+			return fmt.Errorf("eon: cannot set %s as %s is not a block", path, strings.Join(keys[:i+1], "."))
+		}
+		parent = e.value
+	}
+	return nil
+}
+
+// entrySpan returns the byte offsets of the source to remove when deleting the
+// given entry.
+func (d *Document) entrySpan(e *entry) (int, int) {
+	src := d.src
+	start, end := e.start, e.value.end
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	if end < len(src) && (src[end] == ',' || src[end] == ';') {
+		end++
+		for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+			end++
+		}
+	}
+	ls := lineStart(src, start)
+	if strings.TrimLeft(src[ls:start], " \t") != "" {
+		// The entry shares its line with a preceding entry, so remove any
+		// separator between them instead of the line.
+		if end == e.value.end {
+			prev := strings.TrimRight(src[ls:start], " \t")
+			if strings.HasSuffix(prev, ",") || strings.HasSuffix(prev, ";") {
+				start = ls + len(prev) - 1
+			}
+		}
+		return start, end
+	}
+	if strings.HasPrefix(src[end:], "//") {
+		for end < len(src) && src[end] != '\n' {
+			end++
+		}
+	}
+	if end < len(src) && src[end] == '\r' {
+		end++
+	}
+	if end < len(src) && src[end] != '\n' {
+		// Something else follows the entry on the same line, e.g. the closing
+		// brace of its block, so leave the line in place.
+		return start, e.value.end
+	}
+	if end < len(src) {
+		end++
+	}
+	start = ls
+	// Remove any comment lines directly above the entry.
+	for start > 0 {
+		prev := lineStart(src, start-1)
+		if !strings.HasPrefix(strings.TrimLeft(src[prev:start], " \t"), "//") {
+			break
+		}
+		start = prev
+	}
+	return start, end
+}
+
+// insert adds a new entry to the end of the given block.
+func (d *Document) insert(parent *node, key string, v interface{}) error {
+	src := d.src
+	if len(parent.entries) > 0 && parent != d.root && !strings.Contains(src[parent.start:parent.end], "\n") {
+		// Keep inline blocks on a single line, including any blocks within
+		// the new value.
+		k, val, _, err := marshalValue(key, v, OptInline)
+		if err != nil {
+			return err
+		}
+		pos := parent.end - 1
+		return d.reparse(src[:pos] + ", " + formatEntry(k, val, false, "") + src[pos:])
+	}
+	k, val, block, err := marshalValue(key, v, 0)
+	if err != nil {
+		return err
+	}
+	if len(parent.entries) > 0 {
+		last := parent.entries[len(parent.entries)-1]
+		pos := last.value.end
+		indent := lineIndent(src, last.start)
+		entry := formatEntry(k, val, block, indent)
+		if i := strings.IndexByte(src[pos:], '\n'); i >= 0 && (parent == d.root || pos+i < parent.end) {
+			// Add the entry on a line of its own after the last entry, so
+			// that the existing line ending is left untouched.
+			pos += i + 1
+			nl := "\n"
+			if src[pos-2] == '\r' {
+				nl = "\r\n"
+			}
+			return d.reparse(src[:pos] + indent + entry + nl + src[pos:])
+		}
+		if parent == d.root {
+			pos = len(src)
+		}
+		return d.reparse(src[:pos] + lineEnding(src) + indent + entry + src[pos:])
+	}
+	nl := lineEnding(src)
+	if parent == d.root {
+		entry := formatEntry(k, val, block, "")
+		if src != "" && !strings.HasSuffix(src, "\n") {
+			src += nl
+		}
+		return d.reparse(src + entry + nl)
+	}
+	indent := lineIndent(src, parent.start)
+	inner := indent + "\t"
+	entry := formatEntry(k, val, block, inner)
+	pos := parent.end - 1
+	if ls := lineStart(src, pos); ls > parent.start && strings.TrimLeft(src[ls:pos], " \t") == "" {
+		return d.reparse(src[:ls] + inner + entry + nl + src[ls:])
+	}
+	return d.reparse(src[:pos] + nl + inner + entry + nl + indent + src[pos:])
+}
+
+func (d *Document) lookup(keys []string) *node {
+	n := d.root
+	for _, key := range keys {
+		if n.kind != nodeBlock {
+			return nil
+		}
+		e := lastEntry(n, key)
+		if e == nil {
+			return nil
+		}
+		n = e.value
+	}
+	return n
+}
+
+// parent returns the block containing the entry at the given path. It returns
+// a nil error if the block doesn't exist.
+func (d *Document) parent(keys []string) (*node, error) {
+	n := d.lookup(keys[:len(keys)-1])
+	if n == nil {
+		return nil, nil
+	}
+	if n.kind != nodeBlock {
+		return nil, fmt.Errorf("eon: %s is not a block", strings.Join(keys[:len(keys)-1], "."))
+	}
+	return n, nil
+}
+
+// replace rewrites the value of an existing entry, leaving its key and
+// anything after its value untouched.
+func (d *Document) replace(e *entry, v interface{}) error {
+	_, val, block, err := marshalValue(e.key, v, 0)
+	if err != nil {
+		return err
+	}
+	sep := " = "
+	if block {
+		sep = " "
+	}
+	val = reindent(val, lineIndent(d.src, e.start))
+	return d.reparse(d.src[:e.keyEnd] + sep + string(val) + d.src[e.value.end:])
+}
+
+func (d *Document) reparse(src string) error {
+	root, err := parse([]byte(src))
+	if err != nil {
+		return err
+	}
+	d.root = root
+	d.src = src
+	return nil
+}
+
+// ParseDocument parses the given EON data into a Document.
+func ParseDocument(data []byte) (*Document, error) {
+	d := &Document{}
+	if err := d.reparse(string(data)); err != nil {
+		return nil, err
+	}
+	return d, nil
+}
+
+func formatEntry(key, val []byte, block bool, indent string) string {
+	sep := " = "
+	if block {
+		sep = " "
+	}
+	return string(key) + sep + string(reindent(val, indent))
+}
+
+func lastEntry(n *node, key string) *entry {
+	for i := len(n.entries) - 1; i >= 0; i-- {
+		if e := n.entries[i]; e.key == key {
+			return e
+		}
+	}
+	return nil
+}
+
+// lineEnding returns the line ending used by the source, i.e. \r\n if its
+// first line ends with one, and \n otherwise.
+func lineEnding(src string) string {
+	if i := strings.IndexByte(src, '\n'); i > 0 && src[i-1] == '\r' {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// lineIndent returns the leading whitespace of the line containing pos.
+func lineIndent(src string, pos int) string {
+	start := lineStart(src, pos)
+	end := start
+	for end < len(src) && (src[end] == ' ' || src[end] == '\t') {
+		end++
+	}
+	return src[start:end]
+}
+
+func lineStart(src string, pos int) int {
+	return strings.LastIndexByte(src[:pos], '\n') + 1
+}
+
+// reindent prefixes every non-empty line after the first with the given
+// indentation.
+func reindent(v []byte, indent string) []byte {
+	if indent == "" {
+		return v
+	}
+	var buf []byte
+	for i, c := range v {
+		buf = append(buf, c)
+		if c == '\n' && i+1 < len(v) && v[i+1] != '\n' {
+			buf = append(buf, indent...)
+		}
+	}
+	return buf
+}
+
+func splitPath(path string) ([]string, error) {
+	keys := strings.Split(path, ".")
+	for _, key := range keys {
+		if key == "" {
+			return nil, fmt.Errorf("eon: invalid key path %q", path)
+		}
+	}
+	return keys, nil
+}
@@ -0,0 +1,254 @@
+package eon
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+const testDocument = `// Peerbase Authors
+
+tav {
+	name = "tav" // preferred name
+	email = "tav@espians.com"
+	location {
+		area = "London"
+		country = "GB"
+	}
+	tags = {a = 1, b = 2}
+}
+
+// The next contributor.
+alice {
+	name = "alice"
+}
+`
+
+func TestDocumentAuthors(t *testing.T) {
+	src, err := ioutil.ReadFile("../AUTHORS.eon")
+	if err != nil {
+		t.Fatalf("unable to read AUTHORS.eon: %s", err)
+	}
+	doc, err := ParseDocument(src)
+	if err != nil {
+		t.Fatalf("unexpected error when parsing AUTHORS.eon: %s", err)
+	}
+	type Location struct {
+		Area    string
+		Country string
+	}
+	type Author struct {
+		Name     string
+		Email    string
+		Location Location
+	}
+	err = doc.Set("alice", Author{
+		Name:     "Alice",
+		Email:    "alice@example.com",
+		Location: Location{"Paris", "FR"},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error when adding an author: %s", err)
+	}
+	out := string(doc.Bytes())
+	if !strings.HasPrefix(out, string(src)) {
+		t.Errorf("existing content was modified when adding an author:\n%s", out)
+	}
+	added := out[len(src):]
+	expect := "alice {\n\tname = \"Alice\"\n\temail = \"alice@example.com\"\n\tlocation {\n\t\tarea = \"Paris\"\n\t\tcountry = \"FR\"\n\t}\n}\n"
+	if added != expect {
+		t.Errorf("mismatching added author: expected %q, got %q", expect, added)
+	}
+	var a Author
+	if err := doc.Get("alice", &a); err != nil {
+		t.Fatalf("unexpected error when getting added author: %s", err)
+	}
+	if a.Location.Country != "FR" {
+		t.Errorf("mismatching country for added author: got %q", a.Location.Country)
+	}
+	if err := doc.Delete("alice"); err != nil {
+		t.Fatalf("unexpected error when deleting an author: %s", err)
+	}
+	if out := string(doc.Bytes()); out != string(src) {
+		t.Errorf("mismatching document after deleting added author:\n%s", out)
+	}
+}
+
+func TestDocumentDelete(t *testing.T) {
+	type elem struct {
+		path   string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"tav.name", `	name = "tav" // preferred name
+`},
+		{"tav.location.area", `		area = "London"
+`},
+		{"tav.location", `	location {
+		area = "London"
+		country = "GB"
+	}
+`},
+		{"alice", `// The next contributor.
+alice {
+	name = "alice"
+}
+`},
+		{"missing", ""},
+		{"tav.missing.key", ""},
+	} {
+		doc, err := ParseDocument([]byte(testDocument))
+		if err != nil {
+			t.Fatalf("unexpected error when parsing document: %s", err)
+		}
+		if err := doc.Delete(elem.path); err != nil {
+			t.Errorf("unexpected error when deleting %s: %s", elem.path, err)
+			continue
+		}
+		expect := strings.Replace(testDocument, elem.expect, "", 1)
+		if out := string(doc.Bytes()); out != expect {
+			t.Errorf("mismatching document after deleting %s:\nexpected %s\ngot      %s", elem.path, expect, out)
+		}
+		if elem.expect != "" && doc.Has(elem.path) {
+			t.Errorf("document still has %s after deleting it", elem.path)
+		}
+	}
+}
+
+func TestDocumentDeleteInline(t *testing.T) {
+	type elem struct {
+		path   string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"tav.tags.a", "tags = {b = 2}"},
+		{"tav.tags.b", "tags = {a = 1}"},
+	} {
+		doc, err := ParseDocument([]byte(testDocument))
+		if err != nil {
+			t.Fatalf("unexpected error when parsing document: %s", err)
+		}
+		if err := doc.Delete(elem.path); err != nil {
+			t.Errorf("unexpected error when deleting %s: %s", elem.path, err)
+			continue
+		}
+		expect := strings.Replace(testDocument, "tags = {a = 1, b = 2}", elem.expect, 1)
+		if out := string(doc.Bytes()); out != expect {
+			t.Errorf("mismatching document after deleting %s:\nexpected %s\ngot      %s", elem.path, expect, out)
+		}
+	}
+}
+
+func TestDocumentErrors(t *testing.T) {
+	doc, err := ParseDocument([]byte(testDocument))
+	if err != nil {
+		t.Fatalf("unexpected error when parsing document: %s", err)
+	}
+	var s string
+	for _, elem := range []struct {
+		err    error
+		expect string
+	}{
+		{doc.Get("tav.missing", &s), "could not find key tav.missing"},
+		{doc.Get("tav.location", &s), "cannot decode block into a string value for key tav.location"},
+		{doc.Get("tav.name", s), "non-nil pointer"},
+		{doc.Set("tav.name.first", "x"), "cannot set tav.name.first as tav.name is not a block"},
+		{doc.Set("tav..name", "x"), "invalid key path"},
+		{doc.Delete("tav.name.first"), "tav.name is not a block"},
+	} {
+		if elem.err == nil {
+			t.Errorf("failed to receive expected error %q", elem.expect)
+			continue
+		}
+		if !strings.Contains(elem.err.Error(), elem.expect) {
+			t.Errorf("mismatching error: expected %q, got %q", elem.expect, elem.err)
+		}
+	}
+	if out := string(doc.Bytes()); out != testDocument {
+		t.Errorf("document was modified by failing operations:\n%s", out)
+	}
+}
+
+func TestDocumentSet(t *testing.T) {
+	type elem struct {
+		path   string
+		value  interface{}
+		old    string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"tav.name", "Tav", `name = "tav" //`, `name = "Tav" //`},
+		{"tav.location.area", "Bristol", `area = "London"`, `area = "Bristol"`},
+		{"tav.location", map[string]string{"area": "Paris"}, "location {\n\t\tarea = \"London\"\n\t\tcountry = \"GB\"\n\t}", "location {\n\t\tarea = \"Paris\"\n\t}"},
+		{"tav.email", []string{"a", "b"}, `email = "tav@espians.com"`, `email = ["a" "b"]`},
+		{"tav.bio", "multi\nline", "\ttags = {a = 1, b = 2}\n", "\ttags = {a = 1, b = 2}\n\tbio = \"\"\"\n\t\tmulti\n\t\tline\n\t\t\"\"\"\n"},
+		{"tav.tags.c", 3, `{a = 1, b = 2}`, `{a = 1, b = 2, c = 3}`},
+		{"tav.tags.z", map[string]int{"q": 1}, `{a = 1, b = 2}`, `{a = 1, b = 2, z = {q = 1}}`},
+		{"tav.tags.y.q", []string{"x"}, `{a = 1, b = 2}`, `{a = 1, b = 2, y = {q = ["x"]}}`},
+		{"tav.location.geo.lat", 51.5, "country = \"GB\"\n", "country = \"GB\"\n\t\tgeo {\n\t\t\tlat = 51.5\n\t\t}\n"},
+		{"alice.email", "a@b.c", "name = \"alice\"\n", "name = \"alice\"\n\temail = \"a@b.c\"\n"},
+		{"bob", map[string]int{}, "name = \"alice\"\n}\n", "name = \"alice\"\n}\nbob {}\n"},
+		{"has space", true, "name = \"alice\"\n}\n", "name = \"alice\"\n}\n\"has space\" = true\n"},
+	} {
+		doc, err := ParseDocument([]byte(testDocument))
+		if err != nil {
+			t.Fatalf("unexpected error when parsing document: %s", err)
+		}
+		if err := doc.Set(elem.path, elem.value); err != nil {
+			t.Errorf("unexpected error when setting %s: %s", elem.path, err)
+			continue
+		}
+		expect := strings.Replace(testDocument, elem.old, elem.expect, 1)
+		if out := string(doc.Bytes()); out != expect {
+			t.Errorf("mismatching document after setting %s:\nexpected %s\ngot      %s", elem.path, expect, out)
+		}
+		if !doc.Has(elem.path) {
+			t.Errorf("document is missing %s after setting it", elem.path)
+		}
+	}
+}
+
+func TestDocumentSetCRLF(t *testing.T) {
+	src := "name = \"tav\"\r\nauthor {\r\n\tarea = \"London\" // home\r\n}\r\n"
+	doc, err := ParseDocument([]byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error when parsing document: %s", err)
+	}
+	if err := doc.Set("author.country", "GB"); err != nil {
+		t.Fatalf("unexpected error when setting author.country: %s", err)
+	}
+	if err := doc.Set("port", 8080); err != nil {
+		t.Fatalf("unexpected error when setting port: %s", err)
+	}
+	expect := "name = \"tav\"\r\nauthor {\r\n\tarea = \"London\" // home\r\n\tcountry = \"GB\"\r\n}\r\nport = 8080\r\n"
+	if out := string(doc.Bytes()); out != expect {
+		t.Errorf("mismatching document after setting keys with CRLF line endings: expected %q, got %q", expect, out)
+	}
+}
+
+func TestDocumentSetEmpty(t *testing.T) {
+	type elem struct {
+		src    string
+		path   string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"", "a", "a = 1\n"},
+		{"// header", "a", "// header\na = 1\n"},
+		{"x {}", "x.a", "x {\n\ta = 1\n}"},
+		{"x {\n}", "x.a", "x {\n\ta = 1\n}"},
+		{"x {\n\ty {\n\t}\n}", "x.y.a", "x {\n\ty {\n\t\ta = 1\n\t}\n}"},
+	} {
+		doc, err := ParseDocument([]byte(elem.src))
+		if err != nil {
+			t.Fatalf("unexpected error when parsing %q: %s", elem.src, err)
+		}
+		if err := doc.Set(elem.path, 1); err != nil {
+			t.Errorf("unexpected error when setting %s in %q: %s", elem.path, elem.src, err)
+			continue
+		}
+		if out := string(doc.Bytes()); out != elem.expect {
+			t.Errorf("mismatching document after setting %s in %q: expected %q, got %q", elem.path, elem.src, elem.expect, out)
+		}
+	}
+}
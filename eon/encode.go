@@ -2,15 +2,21 @@ package eon
 
 import (
 	"bytes"
+	"encoding"
+	"encoding/base64"
 	"fmt"
+	"io"
 	"math"
 	"reflect"
+	"sort"
 	"strconv"
+	"strings"
 	"sync"
 	"time"
 	"unicode/utf8"
 
 	"peerbase.net/go/bytesize"
+	"peerbase.net/go/semver"
 )
 
 // Encoding options.
@@ -18,24 +24,44 @@ const (
 	OptInline EncodeOpts = 1 << iota
 	OptMultiline
 	OptToplevel
+	OptHex
 )
 
+// flushSize is the size past which the output buffered by an Encoder is
+// written out to the underlying writer.
+const flushSize = 32 << 10
+
 const hex = "0123456789abcdef"
 
+// startDetectingCyclesAfter is the nesting depth of pointers, maps, and slices
+// after which the encoder starts tracking the values that it has visited. This
+// keeps the cost of cycle detection off the common case of shallow values.
+const startDetectingCyclesAfter = 1000
+
 var (
 	encoders sync.Map
 	mstates  sync.Pool
 )
 
 var (
-	bytesizeType  = reflect.TypeOf(bytesize.Value(0))
-	marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
-	durationType  = reflect.TypeOf(time.Duration(0))
+	bytesizeType        = reflect.TypeOf(bytesize.Value(0))
+	dateType            = reflect.TypeOf(Date{})
+	marshalerType       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	durationType        = reflect.TypeOf(time.Duration(0))
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+	timeType            = reflect.TypeOf(time.Time{})
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	versionType         = reflect.TypeOf(semver.Version{})
 )
 
 // EncodeOpts defines the various options for a value encoder.
 type EncodeOpts int
 
+func (e EncodeOpts) hex() bool {
+	return e&OptHex != 0
+}
+
 func (e EncodeOpts) inline() bool {
 	return e&OptInline != 0
 }
@@ -44,70 +70,372 @@ func (e EncodeOpts) multiline() bool {
 	return e&OptMultiline != 0
 }
 
+func (e EncodeOpts) toplevel() bool {
+	return e&OptToplevel != 0
+}
+
 type arrayEncoder struct {
 	elem encoder
 	size int
 }
 
+// encode writes an array as a list. Unlike slices, arrays can't form cycles by
+// themselves, so there's no need to track them.
 func (e *arrayEncoder) encode(m *mstate, rv reflect.Value, opts EncodeOpts) error {
-	return nil
+	return encodeList(m, rv, e.elem, opts)
+}
+
+type cycleKey struct {
+	len int
+	ptr uintptr
+	typ reflect.Type
 }
 
 type encoder func(*mstate, reflect.Value, EncodeOpts) error
 
 type fieldEncoder struct {
-	enc  encoder
-	idx  int
-	name string
+	block     func(reflect.Value) bool
+	enc       encoder
+	hex       bool
+	index     []int
+	inline    bool
+	multiline bool
+	name      string
+	omitempty bool
 }
 
 type mapEncoder struct {
-	key   encoder
-	value encoder
+	block    func(reflect.Value) bool
+	textKeys bool
+	value    encoder
 }
 
+// encode writes the entries of a map as a block, sorted by key so that the
+// output is deterministic.
 func (e *mapEncoder) encode(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	if err := m.enter(rv); err != nil {
+		return err
+	}
+	defer m.exit(rv)
+	keys := rv.MapKeys()
+	entries := make([]mapEntry, len(keys))
+	for i, k := range keys {
+		entries[i].value = rv.MapIndex(k)
+		if !e.textKeys {
+			entries[i].key = k.String()
+			continue
+		}
+		if k.Kind() == reflect.Ptr && k.IsNil() {
+			return m.errorf(k.Type(), "cannot encode nil map key of type %s", k.Type())
+		}
+		key, err := k.Interface().(encoding.TextMarshaler).MarshalText()
+		if err != nil {
+			return err
+		}
+		entries[i].key = string(key)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].key < entries[j].key
+	})
+	vopts := opts & (OptHex | OptInline)
+	m.openBlock(opts)
+	for i, entry := range entries {
+		m.writeEntry(entry.key, i, opts, e.block != nil && !vopts.inline() && e.block(entry.value))
+		m.path = append(m.path, entry.key)
+		if err := e.value(m, entry.value, vopts); err != nil {
+			return err
+		}
+		m.path = m.path[:len(m.path)-1]
+	}
+	m.closeBlock(opts, len(entries))
 	return nil
 }
 
+type mapEntry struct {
+	key   string
+	value reflect.Value
+}
+
 type mstate struct {
 	bytes.Buffer
 	commented map[string]bool
 	comments  map[string]string
+	depth     int
+	err       error
+	flushed   int
+	hold      int
 	indent    int
+	indentBy  string
+	path      []string
 	scratch   [64]byte
+	seen      map[cycleKey]int
+	w         io.Writer
+	width     int
 }
 
-type sliceEncoder struct {
-	elem   encoder
-	inline bool
+// closeBlock ends a block that was started with openBlock, given the number of
+// entries that were written within it.
+func (m *mstate) closeBlock(opts EncodeOpts, written int) {
+	if opts.toplevel() {
+		return
+	}
+	if !opts.inline() {
+		m.indent--
+		if written > 0 {
+			m.WriteByte('\n')
+			m.writeIndent()
+		}
+	}
+	m.WriteByte('}')
 }
 
-func (e *sliceEncoder) encode(m *mstate, rv reflect.Value, opts EncodeOpts) error {
-	if e.inline {
-		m.WriteByte('[')
+// column returns the number of bytes written since the start of the current
+// line, including any that have already been flushed.
+func (m *mstate) column() int {
+	b := m.Bytes()
+	if i := bytes.LastIndexByte(b, '\n'); i >= 0 {
+		return len(b) - i - 1
 	}
-	n := rv.Len()
-	for i := 0; i < n; i++ {
-		if e.inline && i != 0 {
-			m.WriteByte(' ')
+	return m.flushed + len(b)
+}
+
+// enter must be called before encoding the contents of a pointer, map, or
+// slice. Once the nesting depth passes startDetectingCyclesAfter, it returns
+// an error if the value has already been visited on the current path. The
+// error names the key at which the cycle begins, rather than the one at which
+// it was detected, as the latter is over a thousand levels deep.
+func (m *mstate) enter(rv reflect.Value) error {
+	m.depth++
+	if m.depth <= startDetectingCyclesAfter {
+		return nil
+	}
+	key := cycleKey{ptr: rv.Pointer(), typ: rv.Type()}
+	if rv.Kind() == reflect.Slice {
+		key.len = rv.Len()
+	}
+	if start, ok := m.seen[key]; ok {
+		// Walk back through the path for as long as it repeats the keys
+		// within the cycle, to find where the cycle first began.
+		n := len(m.path) - start
+		for n > 0 && start > 0 && m.path[start-1] == m.path[start-1+n] {
+			start--
 		}
-		e.elem(m, rv.Index(i), 0)
+		err := m.errorf(rv.Type(), "encountered a cycle via %s", rv.Type())
+		err.Key = strings.Join(m.path[:start], ".")
+		return err
 	}
-	if e.inline {
-		m.WriteByte(']')
+	if m.seen == nil {
+		m.seen = map[cycleKey]int{}
 	}
+	m.seen[key] = len(m.path)
 	return nil
 }
 
+// errorf returns a TypeError for a value of the given type at the current path.
+func (m *mstate) errorf(rt reflect.Type, format string, args ...interface{}) *TypeError {
+	return &TypeError{
+		Key:  strings.Join(m.path, "."),
+		Msg:  fmt.Sprintf(format, args...),
+		Type: rt,
+	}
+}
+
+// exit must be called after encoding a value that was passed to enter.
+func (m *mstate) exit(rv reflect.Value) {
+	if m.depth > startDetectingCyclesAfter {
+		key := cycleKey{ptr: rv.Pointer(), typ: rv.Type()}
+		if rv.Kind() == reflect.Slice {
+			key.len = rv.Len()
+		}
+		delete(m.seen, key)
+	}
+	m.depth--
+}
+
+// flush writes out the buffered output once it has grown past flushSize, if
+// the state is streaming to a writer. It must only be called between values,
+// so that encoders are free to rewrite the output of the current value, and it
+// does nothing while hold is set by an encoder that may rewrite its output.
+func (m *mstate) flush() {
+	if m.w == nil || m.err != nil || m.hold > 0 || m.Len() < flushSize {
+		return
+	}
+	m.flushed = m.column()
+	_, m.err = m.w.Write(m.Bytes())
+	m.Reset()
+}
+
+// openBlock starts a block of entries. Top-level blocks are written without
+// any enclosing braces, and inline blocks are written on a single line, e.g.
+// {name = "tav", age = 42}.
+func (m *mstate) openBlock(opts EncodeOpts) {
+	if opts.toplevel() {
+		return
+	}
+	m.WriteByte('{')
+	if !opts.inline() {
+		m.indent++
+	}
+}
+
+// writeEntry writes the separator and key for the next entry within a block.
+// If the entry's value is going to be written as a multi-line block, the key is
+// followed by a space, and otherwise by an assignment.
+func (m *mstate) writeEntry(key string, written int, opts EncodeOpts, block bool) {
+	m.flush()
+	if opts.inline() {
+		if written > 0 {
+			m.WriteString(", ")
+		}
+	} else {
+		if written > 0 || !opts.toplevel() {
+			m.WriteByte('\n')
+		}
+		if m.comments != nil {
+			path := key
+			if len(m.path) > 0 {
+				path = strings.Join(m.path, ".") + "." + key
+			}
+			m.writeComment(path)
+		}
+		m.writeIndent()
+	}
+	m.writeKey(key)
+	if block {
+		m.WriteByte(' ')
+	} else {
+		m.WriteString(" = ")
+	}
+}
+
+// writeComment writes the comment for the given key path, if there is one and
+// it hasn't already been written, as a sequence of // lines at the current
+// indentation level.
+func (m *mstate) writeComment(path string) bool {
+	comment, ok := m.comments[path]
+	if !ok || m.commented[path] {
+		return false
+	}
+	m.commented[path] = true
+	for _, line := range strings.Split(strings.TrimRight(comment, "\r\n"), "\n") {
+		m.writeIndent()
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			m.WriteString("//\n")
+			continue
+		}
+		m.WriteString("// ")
+		m.WriteString(line)
+		m.WriteByte('\n')
+	}
+	return true
+}
+
+func (m *mstate) writeIndent() {
+	for i := 0; i < m.indent; i++ {
+		m.WriteString(m.indentBy)
+	}
+}
+
+// writeKey writes the given key, quoting it if it is not a valid identifier,
+// or if it is one of the keywords true, false, and null.
+func (m *mstate) writeKey(key string) {
+	if isIdent(key) && !isKeyword(key) {
+		m.WriteString(key)
+		return
+	}
+	encodeString(m, reflect.ValueOf(key), OptInline)
+}
+
+// wrap returns a TypeError for a value of the given type at the current path,
+// which wraps one of the package's error values.
+func (m *mstate) wrap(rt reflect.Type, err error) error {
+	terr := m.errorf(rt, "%s", strings.TrimPrefix(err.Error(), "eon: "))
+	terr.Err = err
+	return terr
+}
+
+type ptrEncoder struct {
+	elem encoder
+}
+
+func (e *ptrEncoder) encode(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	if rv.IsNil() {
+		m.WriteString("null")
+		return nil
+	}
+	if err := m.enter(rv); err != nil {
+		return err
+	}
+	defer m.exit(rv)
+	return e.elem(m, rv.Elem(), opts)
+}
+
+type sliceEncoder struct {
+	elem encoder
+}
+
+func (e *sliceEncoder) encode(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	if !rv.IsNil() {
+		if err := m.enter(rv); err != nil {
+			return err
+		}
+		defer m.exit(rv)
+	}
+	return encodeList(m, rv, e.elem, opts)
+}
+
 type structEncoder struct {
 	fields []*fieldEncoder
 }
 
 func (e *structEncoder) encode(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	m.openBlock(opts)
+	written := 0
+	for _, f := range e.fields {
+		fv, ok := fieldByIndex(rv, f.index)
+		if !ok || (f.omitempty && isEmptyValue(fv)) {
+			continue
+		}
+		fopts := opts & OptInline
+		if f.hex {
+			fopts |= OptHex
+		}
+		if f.inline {
+			fopts |= OptInline
+		} else if f.multiline {
+			fopts |= OptMultiline
+		}
+		m.writeEntry(f.name, written, opts, f.block != nil && !fopts.inline() && f.block(fv))
+		m.path = append(m.path, f.name)
+		if err := f.enc(m, fv, fopts); err != nil {
+			return err
+		}
+		m.path = m.path[:len(m.path)-1]
+		written++
+	}
+	m.closeBlock(opts, written)
 	return nil
 }
 
+// encodeBinary writes a binary literal, using base64 by default, or hex if the
+// OptHex option has been set.
+func encodeBinary(m *mstate, v []byte, opts EncodeOpts) {
+	if opts.hex() {
+		m.WriteString(`hex"`)
+		for _, c := range v {
+			m.WriteByte(hex[c>>4])
+			m.WriteByte(hex[c&0xf])
+		}
+	} else {
+		m.WriteString(`b64"`)
+		enc := base64.NewEncoder(base64.StdEncoding, m)
+		enc.Write(v)
+		enc.Close()
+	}
+	m.WriteByte('"')
+}
+
 func encodeBool(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 	if rv.Bool() {
 		m.WriteString("true")
@@ -117,13 +445,17 @@ func encodeBool(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 	return nil
 }
 
+// encodeByteArray writes a byte array as a binary literal.
+func encodeByteArray(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	v := make([]byte, rv.Len())
+	reflect.Copy(reflect.ValueOf(v), rv)
+	encodeBinary(m, v, opts)
+	return nil
+}
+
+// encodeByteSlice writes a byte slice as a binary literal.
 func encodeByteSlice(m *mstate, rv reflect.Value, opts EncodeOpts) error {
-	v := rv.String()
-	start := m.Len()
-	m.WriteByte('"')
-	_ = start
-	_ = v
-	m.WriteByte('"')
+	encodeBinary(m, rv.Bytes(), opts)
 	return nil
 }
 
@@ -132,31 +464,57 @@ func encodeByteSize(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 	return nil
 }
 
+func encodeDate(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	v := rv.Interface().(Date)
+	if !v.IsValid() {
+		return m.errorf(rv.Type(), "cannot encode invalid date %s", v)
+	}
+	m.WriteString(v.String())
+	return nil
+}
+
 func encodeDuration(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 	m.WriteString(time.Duration(rv.Int()).String())
 	return nil
 }
 
-func encodeFloat(m *mstate, v float64, bits int) error {
+func encodeFloat(m *mstate, rv reflect.Value, bits int) error {
+	v := rv.Float()
 	if v > math.MaxFloat64 {
-		return ErrFloatInf
+		return m.wrap(rv.Type(), ErrFloatInf)
 	}
 	if v < -math.MaxFloat64 {
-		return ErrFloatInf
+		return m.wrap(rv.Type(), ErrFloatInf)
 	}
 	if v != v {
-		return ErrFloatNaN
+		return m.wrap(rv.Type(), ErrFloatNaN)
 	}
 	m.Write(strconv.AppendFloat(m.scratch[:0], v, 'f', -1, bits))
 	return nil
 }
 
 func encodeFloat32(m *mstate, rv reflect.Value, opts EncodeOpts) error {
-	return encodeFloat(m, rv.Float(), 32)
+	return encodeFloat(m, rv, 32)
 }
 
 func encodeFloat64(m *mstate, rv reflect.Value, opts EncodeOpts) error {
-	return encodeFloat(m, rv.Float(), 64)
+	return encodeFloat(m, rv, 64)
+}
+
+func encodeInlineList(m *mstate, rv reflect.Value, elem encoder, opts EncodeOpts) error {
+	elemOpts := opts&OptHex | OptInline
+	m.WriteByte('[')
+	for i, n := 0, rv.Len(); i < n; i++ {
+		if i != 0 {
+			m.WriteByte(' ')
+		}
+		m.flush()
+		if err := elem(m, rv.Index(i), elemOpts); err != nil {
+			return err
+		}
+	}
+	m.WriteByte(']')
+	return nil
 }
 
 func encodeInt(m *mstate, rv reflect.Value, opts EncodeOpts) error {
@@ -164,7 +522,45 @@ func encodeInt(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 	return nil
 }
 
+// encodeAddrMarshaler encodes values whose pointer type implements Marshaler.
+// Values that aren't addressable are copied so that the method can still be
+// called.
+func encodeAddrMarshaler(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	if rv.CanAddr() {
+		return encodeMarshaler(m, rv.Addr(), opts)
+	}
+	ptr := reflect.New(rv.Type())
+	ptr.Elem().Set(rv)
+	return encodeMarshaler(m, ptr, opts)
+}
+
+func encodeAddrTextMarshaler(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	if rv.CanAddr() {
+		return encodeTextMarshaler(m, rv.Addr(), opts)
+	}
+	ptr := reflect.New(rv.Type())
+	ptr.Elem().Set(rv)
+	return encodeTextMarshaler(m, ptr, opts)
+}
+
+func encodeInterface(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	if rv.IsNil() {
+		m.WriteString("null")
+		return nil
+	}
+	elem := rv.Elem()
+	enc, err := getEncoder(elem.Type())
+	if err != nil {
+		return err
+	}
+	return enc(m, elem, opts)
+}
+
 func encodeMarshaler(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		m.WriteString("null")
+		return nil
+	}
 	v := rv.Interface().(Marshaler)
 	out, err := v.MarshalEON(m.scratch[:0], opts)
 	if err != nil {
@@ -176,6 +572,10 @@ func encodeMarshaler(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 
 func encodeString(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 	v := rv.String()
+	if v != "" && opts.multiline() && !opts.inline() {
+		encodeMultiline(m, v)
+		return nil
+	}
 	start := m.Len()
 	m.WriteByte('"')
 	from := 0
@@ -233,13 +633,152 @@ func encodeString(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 	return nil
 }
 
-func encodeMultiline(m *mstate, v string) {}
+// encodeList writes the elements of an array or slice as a list. Lists are
+// written inline, e.g. [1 2 3], unless the multiline option is set, or a line
+// width has been set and the inline form would extend past it, in which case
+// each element is written inline on a line of its own.
+func encodeList(m *mstate, rv reflect.Value, elem encoder, opts EncodeOpts) error {
+	n := rv.Len()
+	if n == 0 || opts.inline() || (!opts.multiline() && m.width == 0) {
+		return encodeInlineList(m, rv, elem, opts)
+	}
+	if !opts.multiline() {
+		start := m.Len()
+		m.hold++
+		err := encodeInlineList(m, rv, elem, opts)
+		m.hold--
+		if err != nil || m.column() <= m.width {
+			return err
+		}
+		m.Truncate(start)
+	}
+	elemOpts := opts&OptHex | OptInline
+	m.WriteByte('[')
+	m.indent++
+	for i := 0; i < n; i++ {
+		m.WriteByte('\n')
+		m.writeIndent()
+		m.flush()
+		if err := elem(m, rv.Index(i), elemOpts); err != nil {
+			return err
+		}
+	}
+	m.indent--
+	m.WriteByte('\n')
+	m.writeIndent()
+	m.WriteByte(']')
+	return nil
+}
+
+// encodeMultiline writes a string as a multiline literal, with each line of the
+// string on a separate line between """ delimiters. The lines, as well as the
+// closing delimiter, are indented one level deeper than the current block. On
+// decoding, the indentation of the closing delimiter is stripped from each
+// line, so that the original string is recovered exactly.
+func encodeMultiline(m *mstate, v string) {
+	m.WriteString(`"""`)
+	m.indent++
+	for _, line := range strings.Split(v, "\n") {
+		m.WriteByte('\n')
+		if line != "" {
+			m.writeIndent()
+			encodeMultilineText(m, line)
+		}
+	}
+	m.WriteByte('\n')
+	m.writeIndent()
+	m.WriteString(`"""`)
+	m.indent--
+}
+
+// encodeMultilineText writes a single line of a multiline literal. Besides the
+// usual escaping of backslashes and control characters, every third quote in a
+// run of quotes is escaped so that the content never contains the """
+// delimiter, and trailing whitespace is escaped so that it survives editors
+// which strip it.
+func encodeMultilineText(m *mstate, v string) {
+	quotes := 0
+	for i := 0; i < len(v); {
+		c := v[i]
+		if c == '"' {
+			quotes++
+			if quotes%3 == 0 {
+				m.WriteByte('\\')
+			}
+			m.WriteByte(c)
+			i++
+			continue
+		}
+		quotes = 0
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '\\':
+				m.WriteString(`\\`)
+			case c == '\t' && i == len(v)-1:
+				m.WriteString(`\t`)
+			case c == ' ' && i == len(v)-1:
+				m.WriteString(`\x20`)
+			case c == '\t' || isPrintable(c):
+				m.WriteByte(c)
+			case c == '\r':
+				m.WriteString(`\r`)
+			default:
+				m.WriteString(`\x`)
+				m.WriteByte(hex[c>>4])
+				m.WriteByte(hex[c&0xf])
+			}
+			i++
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(v[i:])
+		if r == utf8.RuneError && size == 1 {
+			m.WriteString(`\ufffd`)
+		} else {
+			m.WriteString(v[i : i+size])
+		}
+		i += size
+	}
+}
+
+// encodeTextMarshaler encodes the output of a value's MarshalText method as a
+// string.
+func encodeTextMarshaler(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	if rv.Kind() == reflect.Ptr && rv.IsNil() {
+		m.WriteString("null")
+		return nil
+	}
+	out, err := rv.Interface().(encoding.TextMarshaler).MarshalText()
+	if err != nil {
+		return m.errorf(rv.Type(), "error calling MarshalText for type %s: %s", rv.Type(), err)
+	}
+	return encodeString(m, reflect.ValueOf(string(out)), opts)
+}
+
+// encodeTime encodes a time as an RFC 3339 timestamp. The UTC offset of the
+// time's location is retained, but not the name of the location itself.
+func encodeTime(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	v := rv.Interface().(time.Time)
+	if year := v.Year(); year < 0 || year > 9999 {
+		return m.errorf(rv.Type(), "cannot encode time with year %d outside of the range 0-9999", year)
+	}
+	m.WriteString(v.Format(time.RFC3339Nano))
+	return nil
+}
 
 func encodeUint(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 	m.Write(strconv.AppendUint(m.scratch[:0], rv.Uint(), 10))
 	return nil
 }
 
+func encodeVersion(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	v := rv.Interface().(semver.Version)
+	if err := v.Validate(); err != nil {
+		return m.errorf(rv.Type(), "cannot encode version %s: %s", v, strings.TrimPrefix(err.Error(), "semver: "))
+	}
+	m.WriteString(v.String())
+	return nil
+}
+
 func getEncoder(rt reflect.Type) (encoder, error) {
 	if enc, ok := encoders.Load(rt); ok {
 		return enc.(encoder), nil
@@ -251,13 +790,13 @@ func getEncoder(rt reflect.Type) (encoder, error) {
 	)
 	wg.Add(1)
 	// Add a temporary handler to deal with recursive types.
-	actual, loaded := encoders.LoadOrStore(rt, func(m *mstate, rv reflect.Value, opts EncodeOpts) error {
+	actual, loaded := encoders.LoadOrStore(rt, encoder(func(m *mstate, rv reflect.Value, opts EncodeOpts) error {
 		wg.Wait()
 		if err != nil {
 			return err
 		}
 		return enc(m, rv, opts)
-	})
+	}))
 	if loaded {
 		return actual.(encoder), nil
 	}
@@ -269,6 +808,109 @@ func getEncoder(rt reflect.Type) (encoder, error) {
 	return enc, err
 }
 
+// blockFunc returns a function that reports whether a value of the given type
+// will be encoded as a block. It returns nil if values of the type are never
+// encoded as blocks.
+func blockFunc(rt reflect.Type) func(reflect.Value) bool {
+	switch rt.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		return isBlockValue
+	case reflect.Map, reflect.Struct:
+		if isLiteral(rt) {
+			return nil
+		}
+		return isBlock
+	}
+	return nil
+}
+
+func isBlock(rv reflect.Value) bool {
+	return true
+}
+
+// isBlockValue returns whether the given value will be encoded as a block,
+// after resolving any pointers and interfaces.
+func isBlockValue(rv reflect.Value) bool {
+	for {
+		kind := rv.Kind()
+		if kind != reflect.Interface && kind != reflect.Ptr {
+			break
+		}
+		if rv.IsNil() || (kind == reflect.Ptr && isMarshaler(rv.Type())) {
+			return false
+		}
+		rv = rv.Elem()
+	}
+	kind := rv.Kind()
+	return (kind == reflect.Map || kind == reflect.Struct) && !isLiteral(rv.Type())
+}
+
+func isEmptyValue(rv reflect.Value) bool {
+	switch rv.Kind() {
+	case reflect.Array, reflect.Map, reflect.Slice, reflect.String:
+		return rv.Len() == 0
+	case reflect.Bool:
+		return !rv.Bool()
+	case reflect.Float32, reflect.Float64:
+		return rv.Float() == 0
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int() == 0
+	case reflect.Interface, reflect.Ptr:
+		return rv.IsNil()
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return rv.Uint() == 0
+	}
+	return false
+}
+
+func isIdent(s string) bool {
+	for i, r := range s {
+		if i == 0 {
+			if !isIdentStart(r) {
+				return false
+			}
+		} else if !isIdentChar(r) {
+			return false
+		}
+	}
+	return s != ""
+}
+
+// isLiteral returns whether values of the given map or struct type are encoded
+// as a single value instead of a block, e.g. time.Time values.
+func isLiteral(rt reflect.Type) bool {
+	switch rt {
+	case dateType, timeType, versionType:
+		return true
+	}
+	return isMarshaler(rt) || isTextMarshaler(rt)
+}
+
+// isMarshaler returns whether the given type, or a pointer to it, implements
+// the Marshaler interface.
+func isMarshaler(rt reflect.Type) bool {
+	if rt.Implements(marshalerType) {
+		return true
+	}
+	return rt.Kind() != reflect.Ptr && reflect.PtrTo(rt).Implements(marshalerType)
+}
+
+// isTextMarshaler returns whether values of the given type should be encoded
+// with the encoding.TextMarshaler interface, i.e. if the type, or a pointer to
+// it, implements the interface and the type has no native EON encoding.
+// Pointer and interface types are excluded, so that they are encoded as the
+// value that they point to or contain.
+func isTextMarshaler(rt reflect.Type) bool {
+	switch rt.Kind() {
+	case reflect.Interface, reflect.Ptr:
+		return false
+	}
+	if rt == timeType {
+		return false
+	}
+	return rt.Implements(textMarshalerType) || reflect.PtrTo(rt).Implements(textMarshalerType)
+}
+
 func isPrintable(c byte) bool {
 	if c > 34 && c < 127 {
 		return true
@@ -276,26 +918,63 @@ func isPrintable(c byte) bool {
 	return c == 32 || c == 33
 }
 
-func marshal(v interface{}, comments map[string]string) ([]byte, error) {
+func marshal(v interface{}, opts *MarshalOptions) ([]byte, error) {
 	rv := reflect.ValueOf(v)
 	if !rv.IsValid() {
 		return nil, ErrNilInterfaceValue
 	}
+	if strings.Trim(opts.Indent, " \t") != "" {
+		return nil, fmt.Errorf("eon: invalid indent %q: only spaces and tabs are allowed", opts.Indent)
+	}
 	enc, err := getEncoder(rv.Type())
 	if err != nil {
 		return nil, err
 	}
-	m := newMstate(comments)
+	m := newMstate(opts)
+	if m.comments != nil && m.writeComment("") {
+		m.WriteByte('\n')
+	}
 	if err = enc(m, rv, OptToplevel); err != nil {
 		mstates.Put(m)
 		return nil, err
 	}
+	if opts.TrailingNewline && m.Len() > 0 {
+		m.WriteByte('\n')
+	}
 	out := make([]byte, m.Len())
 	copy(out, m.Bytes())
 	mstates.Put(m)
 	return out, nil
 }
 
+// marshalValue returns the encoding of v, with the given options, for use as
+// the value of an entry, i.e. with blocks enclosed in braces, along with the
+// key written in the same form as Marshal would use. It also returns whether
+// the value is a block.
+func marshalValue(key string, v interface{}, opts EncodeOpts) ([]byte, []byte, bool, error) {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return nil, nil, false, ErrNilInterfaceValue
+	}
+	enc, err := getEncoder(rv.Type())
+	if err != nil {
+		return nil, nil, false, err
+	}
+	m := newMstate(nil)
+	m.writeKey(key)
+	k := make([]byte, m.Len())
+	copy(k, m.Bytes())
+	m.Reset()
+	if err = enc(m, rv, opts); err != nil {
+		mstates.Put(m)
+		return nil, nil, false, err
+	}
+	out := make([]byte, m.Len())
+	copy(out, m.Bytes())
+	mstates.Put(m)
+	return k, out, isBlockValue(rv), nil
+}
+
 func newArrayEncoder(rt reflect.Type) (encoder, error) {
 	elem, err := getEncoder(rt.Elem())
 	if err != nil {
@@ -308,40 +987,69 @@ func newArrayEncoder(rt reflect.Type) (encoder, error) {
 }
 
 func newMapEncoder(rt reflect.Type) (encoder, error) {
-	k, err := getEncoder(rt.Key())
-	if err != nil {
-		return nil, err
+	kt := rt.Key()
+	textKeys := false
+	if kt.Kind() != reflect.String {
+		if !kt.Implements(textMarshalerType) {
+			return nil, fmt.Errorf("eon: unsupported map key type %s", kt)
+		}
+		textKeys = true
 	}
 	v, err := getEncoder(rt.Elem())
 	if err != nil {
 		return nil, err
 	}
 	return (&mapEncoder{
-		key:   k,
-		value: v,
+		block:    blockFunc(rt.Elem()),
+		textKeys: textKeys,
+		value:    v,
 	}).encode, nil
 }
 
-func newMstate(comments map[string]string) *mstate {
-	if v := mstates.Get(); v != nil {
-		e := v.(*mstate)
-		e.Reset()
-		if comments == nil {
-			e.commented = nil
-			e.comments = nil
-		} else {
-			e.commented = map[string]bool{}
-			e.comments = comments
+// newMstate returns an mstate from the pool, or a new one, that is set up with
+// the given options. A nil opts gives the default layout.
+func newMstate(opts *MarshalOptions) *mstate {
+	m, ok := mstates.Get().(*mstate)
+	if ok {
+		m.Reset()
+		m.depth = 0
+		m.err = nil
+		m.flushed = 0
+		m.hold = 0
+		m.indent = 0
+		m.path = m.path[:0]
+		for key := range m.seen {
+			delete(m.seen, key)
 		}
-		return e
+		m.w = nil
+	} else {
+		m = &mstate{}
 	}
-	if comments == nil {
-		return &mstate{}
+	m.commented = nil
+	m.comments = nil
+	m.indentBy = "\t"
+	m.width = 0
+	if opts != nil {
+		if opts.Comments != nil {
+			m.commented = map[string]bool{}
+			m.comments = opts.Comments
+		}
+		if opts.Indent != "" {
+			m.indentBy = opts.Indent
+		}
+		m.width = opts.LineWidth
 	}
-	return &mstate{
-		commented: map[string]bool{},
-		comments:  comments,
+	return m
+}
+
+func newPtrEncoder(rt reflect.Type) (encoder, error) {
+	elem, err := getEncoder(rt.Elem())
+	if err != nil {
+		return nil, err
 	}
+	return (&ptrEncoder{
+		elem: elem,
+	}).encode, nil
 }
 
 func newSliceEncoder(rt reflect.Type) (encoder, error) {
@@ -350,28 +1058,26 @@ func newSliceEncoder(rt reflect.Type) (encoder, error) {
 		return nil, err
 	}
 	return (&sliceEncoder{
-		elem:   elem,
-		inline: true,
+		elem: elem,
 	}).encode, nil
 }
 
 func newStructEncoder(rt reflect.Type) (encoder, error) {
 	var fields []*fieldEncoder
-	n := rt.NumField()
-	for i := 0; i < n; i++ {
-		f := rt.Field(i)
-		if f.Anonymous {
-			continue
-		}
-		tag := f.Tag.Get("eon")
-		_ = tag
-		enc, err := getEncoder(f.Type)
+	for _, f := range structFields(rt) {
+		enc, err := getEncoder(f.typ)
 		if err != nil {
 			return nil, err
 		}
 		fields = append(fields, &fieldEncoder{
-			enc: enc,
-			idx: i,
+			block:     blockFunc(f.typ),
+			enc:       enc,
+			hex:       f.hex,
+			index:     f.index,
+			inline:    f.inline,
+			multiline: f.multiline,
+			name:      f.name,
+			omitempty: f.omitempty,
 		})
 	}
 	return (&structEncoder{
@@ -380,12 +1086,29 @@ func newStructEncoder(rt reflect.Type) (encoder, error) {
 }
 
 func typeEncoder(rt reflect.Type) (encoder, error) {
+	// Interface types, e.g. Marshaler itself, are encoded by their dynamic
+	// value, which may be nil.
+	kind := rt.Kind()
+	if kind == reflect.Interface {
+		return encodeInterface, nil
+	}
 	if rt.Implements(marshalerType) {
 		return encodeMarshaler, nil
 	}
-	kind := rt.Kind()
+	if kind != reflect.Ptr && reflect.PtrTo(rt).Implements(marshalerType) {
+		return encodeAddrMarshaler, nil
+	}
+	if isTextMarshaler(rt) {
+		if rt.Implements(textMarshalerType) {
+			return encodeTextMarshaler, nil
+		}
+		return encodeAddrTextMarshaler, nil
+	}
 	switch kind {
 	case reflect.Array:
+		if rt.Elem().Kind() == reflect.Uint8 {
+			return encodeByteArray, nil
+		}
 		return newArrayEncoder(rt)
 	case reflect.Bool:
 		return encodeBool, nil
@@ -403,6 +1126,7 @@ func typeEncoder(rt reflect.Type) (encoder, error) {
 	case reflect.Map:
 		return newMapEncoder(rt)
 	case reflect.Ptr:
+		return newPtrEncoder(rt)
 	case reflect.Slice:
 		if rt.Elem().Kind() == reflect.Uint8 {
 			return encodeByteSlice, nil
@@ -411,6 +1135,14 @@ func typeEncoder(rt reflect.Type) (encoder, error) {
 	case reflect.String:
 		return encodeString, nil
 	case reflect.Struct:
+		switch rt {
+		case dateType:
+			return encodeDate, nil
+		case timeType:
+			return encodeTime, nil
+		case versionType:
+			return encodeVersion, nil
+		}
 		return newStructEncoder(rt)
 	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
 		return encodeUint, nil
@@ -1,12 +1,18 @@
 package eon
 
 import (
+	"fmt"
 	"math"
+	"math/big"
+	"net"
+	"reflect"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
 
 	"peerbase.net/go/bytesize"
+	"peerbase.net/go/semver"
 )
 
 type dummyMarshaler struct {
@@ -17,6 +23,67 @@ func (d dummyMarshaler) MarshalEON(scratch []byte, opts EncodeOpts) ([]byte, err
 	return []byte(strings.ToUpper(d.val)), nil
 }
 
+type ptrMarshaler string
+
+func (p *ptrMarshaler) MarshalEON(scratch []byte, opts EncodeOpts) ([]byte, error) {
+	return []byte(strconv.Quote(strings.ToUpper(string(*p)))), nil
+}
+
+type testKey struct {
+	a string
+	b string
+}
+
+func (k testKey) MarshalText() ([]byte, error) {
+	return []byte(k.a + ":" + k.b), nil
+}
+
+func (k *testKey) UnmarshalText(text []byte) error {
+	parts := strings.SplitN(string(text), ":", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("invalid test key %q", text)
+	}
+	k.a, k.b = parts[0], parts[1]
+	return nil
+}
+
+func TestEncodeArray(t *testing.T) {
+	type Peer struct {
+		ID    [4]byte
+		Hash  [2]byte `eon:",hex"`
+		Ports [2]int
+	}
+	type elem struct {
+		v      interface{}
+		expect string
+	}
+	for _, elem := range []elem{
+		{[3]int{1, 2, 3}, `[1 2 3]`},
+		{[0]string{}, `[]`},
+		{[2][]string{{"a"}, {"b", "c"}}, `[["a"] ["b" "c"]]`},
+		{[2]byte{0xca, 0xfe}, `b64"yv4="`},
+		{Peer{[4]byte{1, 2, 3, 4}, [2]byte{0xbe, 0xef}, [2]int{80, 443}}, "id = b64\"AQIDBA==\"\nhash = hex\"beef\"\nports = [80 443]"},
+	} {
+		out, err := Marshal(elem.v)
+		if err != nil {
+			t.Errorf("unexpected error when encoding array %v: %s", elem.v, err)
+			continue
+		}
+		if elem.expect != string(out) {
+			t.Errorf("mismatching encoded value for array: expected %q, got %q", elem.expect, out)
+			continue
+		}
+		rv := reflect.New(reflect.TypeOf(elem.v))
+		if err := Unmarshal(out, rv.Interface()); err != nil {
+			t.Errorf("unexpected error when decoding %q: %s", out, err)
+			continue
+		}
+		if got := rv.Elem().Interface(); !reflect.DeepEqual(elem.v, got) {
+			t.Errorf("mismatching round-tripped value for array: expected %#v, got %#v", elem.v, got)
+		}
+	}
+}
+
 func TestEncodeBool(t *testing.T) {
 	type elem struct {
 		v      bool
@@ -37,6 +104,45 @@ func TestEncodeBool(t *testing.T) {
 	}
 }
 
+func TestEncodeByteSlice(t *testing.T) {
+	type Key struct {
+		Public []byte
+		Hash   []byte   `eon:",hex"`
+		Hashes [][]byte `eon:",hex"`
+	}
+	type elem struct {
+		v      interface{}
+		expect string
+	}
+	for _, elem := range []elem{
+		{[]byte{}, `b64""`},
+		{[]byte("hello"), `b64"aGVsbG8="`},
+		{[]byte{0xff, 0x00, 0x7f}, `b64"/wB/"`},
+		{
+			Key{[]byte{1, 2, 3}, []byte{0xde, 0xad, 0xbe, 0xef}, [][]byte{{0x0a}, {}}},
+			"public = b64\"AQID\"\nhash = hex\"deadbeef\"\nhashes = [hex\"0a\" hex\"\"]",
+		},
+	} {
+		out, err := Marshal(elem.v)
+		if err != nil {
+			t.Errorf("unexpected error when encoding byte slice %v: %s", elem.v, err)
+			continue
+		}
+		if elem.expect != string(out) {
+			t.Errorf("mismatching encoded value for byte slice: expected %q, got %q", elem.expect, out)
+			continue
+		}
+		rv := reflect.New(reflect.TypeOf(elem.v))
+		if err := Unmarshal(out, rv.Interface()); err != nil {
+			t.Errorf("unexpected error when decoding %q: %s", out, err)
+			continue
+		}
+		if got := rv.Elem().Interface(); !reflect.DeepEqual(elem.v, got) {
+			t.Errorf("mismatching round-tripped value for byte slice: expected %#v, got %#v", elem.v, got)
+		}
+	}
+}
+
 func TestEncodeByteSize(t *testing.T) {
 	type elem struct {
 		v      bytesize.Value
@@ -60,6 +166,68 @@ func TestEncodeByteSize(t *testing.T) {
 	}
 }
 
+func TestEncodeComments(t *testing.T) {
+	type Author struct {
+		Name  string
+		Email string
+	}
+	type Config struct {
+		Format  string
+		Author  Author
+		Origin  Author `eon:",inline"`
+		Plugins map[string]Author
+	}
+	v := Config{
+		Format:  "EON",
+		Author:  Author{"tav", "tav@espians.com"},
+		Origin:  Author{"x", "y"},
+		Plugins: map[string]Author{"lint": {Name: "z"}},
+	}
+	comments := map[string]string{
+		"":                  "Generated config.\n",
+		"format":            "The config format.",
+		"author":            "The primary author.\n\nMust be set.",
+		"author.name":       "Display name.  ",
+		"origin.name":       "Ignored, as origin is inline.",
+		"plugins.lint.name": "Plugin author.",
+		"missing":           "Not a field.",
+	}
+	out, err := MarshalWithComments(v, comments)
+	if err != nil {
+		t.Fatalf("unexpected error when encoding with comments: %s", err)
+	}
+	expect := `// Generated config.
+
+// The config format.
+format = "EON"
+// The primary author.
+//
+// Must be set.
+author {
+	// Display name.
+	name = "tav"
+	email = "tav@espians.com"
+}
+origin = {name = "x", email = "y"}
+plugins {
+	lint {
+		// Plugin author.
+		name = "z"
+		email = ""
+	}
+}`
+	if expect != string(out) {
+		t.Errorf("mismatching encoded value with comments:\nexpected %s\ngot      %s", expect, out)
+	}
+	var got Config
+	if err := Unmarshal(out, &got); err != nil {
+		t.Fatalf("unexpected error when decoding value with comments: %s", err)
+	}
+	if !reflect.DeepEqual(v, got) {
+		t.Errorf("mismatching round-tripped value with comments: expected %#v, got %#v", v, got)
+	}
+}
+
 func TestEncodeComplex(t *testing.T) {
 	_, err := Marshal(5i)
 	if err == nil {
@@ -67,6 +235,77 @@ func TestEncodeComplex(t *testing.T) {
 	}
 }
 
+func TestEncodeCycle(t *testing.T) {
+	type Peer struct {
+		Name string
+		Next *Peer
+	}
+	a := &Peer{Name: "a"}
+	b := &Peer{Name: "b", Next: a}
+	a.Next = b
+	m := map[string]interface{}{}
+	m["self"] = m
+	s := []interface{}{nil}
+	s[0] = s
+	for _, elem := range []struct {
+		v      interface{}
+		expect string
+	}{
+		{a, "eon: encountered a cycle via *eon.Peer"},
+		{m, "eon: encountered a cycle via map[string]interface {}"},
+		{s, "eon: encountered a cycle via []interface {}"},
+		{struct{ Peers *Peer }{a}, "eon: encountered a cycle via *eon.Peer for key peers"},
+		{map[string]interface{}{"x": map[string]interface{}{"y": m}}, "eon: encountered a cycle via map[string]interface {} for key x.y"},
+	} {
+		_, err := Marshal(elem.v)
+		if err == nil {
+			t.Errorf("failed to receive expected error when encoding cyclic %T", elem.v)
+			continue
+		}
+		if _, ok := err.(*TypeError); !ok {
+			t.Errorf("expected TypeError when encoding cyclic %T, got %T", elem.v, err)
+		}
+		if err.Error() != elem.expect {
+			t.Errorf("mismatching error when encoding cyclic %T: expected %q, got %q", elem.v, elem.expect, err)
+		}
+	}
+	// Deep values without cycles should still be encoded.
+	head := &Peer{Name: "0"}
+	for i, cur := 1, head; i < 2*startDetectingCyclesAfter; i++ {
+		cur.Next = &Peer{Name: strconv.Itoa(i)}
+		cur = cur.Next
+	}
+	if _, err := Marshal(head); err != nil {
+		t.Errorf("unexpected error when encoding deep acyclic value: %s", err)
+	}
+}
+
+func TestEncodeDate(t *testing.T) {
+	type elem struct {
+		v      Date
+		expect string
+	}
+	for _, elem := range []elem{
+		{Date{2018, time.September, 1}, "2018-09-01"},
+		{Date{1, time.January, 31}, "0001-01-31"},
+		{Date{2020, time.February, 29}, "2020-02-29"},
+	} {
+		out, err := Marshal(elem.v)
+		if err != nil {
+			t.Errorf("unexpected error when encoding date %v: %s", elem.v, err)
+			continue
+		}
+		if elem.expect != string(out) {
+			t.Errorf("mismatching encoded value for date: expected %q, got %q", elem.expect, out)
+		}
+	}
+	for _, v := range []Date{{}, {2018, time.February, 30}, {10000, time.January, 1}} {
+		if _, err := Marshal(v); err == nil || !strings.Contains(err.Error(), "cannot encode invalid date") {
+			t.Errorf("mismatching error when encoding invalid date %v: got %v", v, err)
+		}
+	}
+}
+
 func TestEncodeDuration(t *testing.T) {
 	type elem struct {
 		v      time.Duration
@@ -300,6 +539,71 @@ func TestEncodeInt64(t *testing.T) {
 	}
 }
 
+func TestEncodeMap(t *testing.T) {
+	v := map[string]map[string]int{
+		"zeta":      {"b": 2, "a": 1},
+		"alpha":     {},
+		"has space": {"\n": 3},
+	}
+	expect := `alpha {}
+"has space" {
+	"\n" = 3
+}
+zeta {
+	a = 1
+	b = 2
+}`
+	for i := 0; i < 5; i++ {
+		out, err := Marshal(v)
+		if err != nil {
+			t.Fatalf("unexpected error when encoding map: %s", err)
+		}
+		if expect != string(out) {
+			t.Fatalf("mismatching encoded value for map:\nexpected:\n%s\ngot:\n%s", expect, out)
+		}
+	}
+	type wrapper struct {
+		Peers map[testKey]string
+		Tags  map[string]string `eon:",inline"`
+	}
+	w := wrapper{
+		Peers: map[testKey]string{{"b", "2"}: "y", {"a", "1"}: "x"},
+		Tags:  map[string]string{"k2": "v2", "k1": "v1"},
+	}
+	out, err := Marshal(w)
+	if err != nil {
+		t.Fatalf("unexpected error when encoding map with text keys: %s", err)
+	}
+	expect = "peers {\n\t\"a:1\" = \"x\"\n\t\"b:2\" = \"y\"\n}\ntags = {k1 = \"v1\", k2 = \"v2\"}"
+	if expect != string(out) {
+		t.Errorf("mismatching encoded value for map with text keys: expected %q, got %q", expect, out)
+	}
+	var got wrapper
+	if err := Unmarshal(out, &got); err != nil {
+		t.Fatalf("unexpected error when decoding map with text keys: %s", err)
+	}
+	if !reflect.DeepEqual(w, got) {
+		t.Errorf("mismatching round-tripped map: expected %#v, got %#v", w, got)
+	}
+	keywords := map[string]int{"true": 1, "false": 2, "null": 3}
+	for _, canonical := range []bool{false, true} {
+		out, err = (MarshalOptions{Canonical: canonical}).Marshal(keywords)
+		if err != nil {
+			t.Fatalf("unexpected error when encoding map with keyword keys: %s", err)
+		}
+		var got map[string]int
+		if err := Unmarshal(out, &got); err != nil {
+			t.Fatalf("unexpected error when decoding map with keyword keys from %q: %s", out, err)
+		}
+		if !reflect.DeepEqual(keywords, got) {
+			t.Errorf("mismatching round-tripped map with keyword keys: expected %v, got %v", keywords, got)
+		}
+	}
+	if _, err := Marshal(map[int]string{1: "a"}); err == nil {
+		t.Errorf("failed to receive expected error when encoding map with int keys")
+	}
+}
+
 func TestEncodeMarshaler(t *testing.T) {
 	type elem struct {
 		v      string
@@ -319,6 +623,227 @@ func TestEncodeMarshaler(t *testing.T) {
 			t.Errorf("mismatching encoded value for marshaler: expected %s, got %s", elem.expect, out)
 		}
 	}
+	// Marshaler-typed fields are encoded by their dynamic value.
+	x := ptrMarshaler("x")
+	for _, field := range []struct {
+		v      Marshaler
+		expect string
+	}{
+		{nil, "m = null"},
+		{(*ptrMarshaler)(nil), "m = null"},
+		{&x, `m = "X"`},
+	} {
+		out, err := Marshal(struct{ M Marshaler }{field.v})
+		if err != nil {
+			t.Errorf("unexpected error when encoding Marshaler field with value %#v: %s", field.v, err)
+			continue
+		}
+		if field.expect != string(out) {
+			t.Errorf("mismatching encoded value for Marshaler field: expected %q, got %q", field.expect, out)
+		}
+	}
+}
+
+func TestEncodeMultiline(t *testing.T) {
+	type script struct {
+		Name   string
+		Source string
+	}
+	type elem struct {
+		v      interface{}
+		expect string
+	}
+	for _, elem := range []elem{
+		{"hello\nworld", "\"\"\"\n\thello\n\tworld\n\t\"\"\""},
+		{"trailing\n", "\"\"\"\n\ttrailing\n\n\t\"\"\""},
+		{"a \"\"\"quoted\"\"\"\"\"\" b\nc\\d", "\"\"\"\n\ta \"\"\\\"quoted\"\"\\\"\"\"\\\" b\n\tc\\\\d\n\t\"\"\""},
+		{"spaces \ntab\t\r\n\n", "\"\"\"\n\tspaces\\x20\n\ttab\t\\r\n\n\n\t\"\"\""},
+		{script{"init", "if x {\n\trun()\n}"}, "name = \"init\"\nsource = \"\"\"\n\tif x {\n\t\trun()\n\t}\n\t\"\"\""},
+		{[]string{"a\nb"}, `["a\nb"]`},
+	} {
+		out, err := Marshal(elem.v)
+		if err != nil {
+			t.Errorf("unexpected error when encoding multiline value %q: %s", elem.v, err)
+			continue
+		}
+		if elem.expect != string(out) {
+			t.Errorf("mismatching encoded value for multiline value: expected %q, got %q", elem.expect, out)
+			continue
+		}
+		dst := reflect.New(reflect.TypeOf(elem.v))
+		if err := Unmarshal(out, dst.Interface()); err != nil {
+			t.Errorf("unexpected error when decoding multiline value %q: %s", out, err)
+			continue
+		}
+		if !reflect.DeepEqual(elem.v, dst.Elem().Interface()) {
+			t.Errorf("mismatching round-tripped multiline value: expected %q, got %q", elem.v, dst.Elem().Interface())
+		}
+	}
+}
+
+func TestEncodeOptions(t *testing.T) {
+	type peer struct {
+		Addr string
+		Port int
+	}
+	type config struct {
+		Name  string
+		Desc  string   `eon:",multiline"`
+		Tags  []string `eon:",multiline"`
+		Ports []int
+		Peers []peer
+		Meta  struct {
+			Notes string
+		}
+	}
+	v := config{
+		Name:  "node1",
+		Desc:  "a test node",
+		Tags:  []string{"relay", "edge"},
+		Ports: []int{8080, 8081, 8082},
+		Peers: []peer{{"10.0.0.1", 8080}, {"10.0.0.2", 9090}},
+	}
+	v.Meta.Notes = "first\nsecond"
+	type elem struct {
+		opts   MarshalOptions
+		expect string
+	}
+	for _, elem := range []elem{
+		{MarshalOptions{}, `name = "node1"
+desc = """
+	a test node
+	"""
+tags = [
+	"relay"
+	"edge"
+]
+ports = [8080 8081 8082]
+peers = [{addr = "10.0.0.1", port = 8080} {addr = "10.0.0.2", port = 9090}]
+meta {
+	notes = """
+		first
+		second
+		"""
+}`},
+		{MarshalOptions{Indent: "  ", LineWidth: 40, TrailingNewline: true}, `name = "node1"
+desc = """
+  a test node
+  """
+tags = [
+  "relay"
+  "edge"
+]
+ports = [8080 8081 8082]
+peers = [
+  {addr = "10.0.0.1", port = 8080}
+  {addr = "10.0.0.2", port = 9090}
+]
+meta {
+  notes = """
+    first
+    second
+    """
+}
+`},
+	} {
+		out, err := elem.opts.Marshal(v)
+		if err != nil {
+			t.Errorf("unexpected error when encoding with options %+v: %s", elem.opts, err)
+			continue
+		}
+		if string(out) != elem.expect {
+			t.Errorf("mismatching encoded value with options %+v: expected %q, got %q", elem.opts, elem.expect, out)
+			continue
+		}
+		var got config
+		if err := Unmarshal(out, &got); err != nil {
+			t.Errorf("unexpected error when decoding %q: %s", out, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, v) {
+			t.Errorf("mismatching round-tripped value: expected %+v, got %+v", v, got)
+		}
+	}
+	if _, err := (MarshalOptions{Indent: "--"}).Marshal(v); err == nil {
+		t.Errorf("failed to receive expected error when encoding with an invalid indent")
+	}
+}
+
+func TestEncodePointer(t *testing.T) {
+	type Location struct {
+		Area string
+	}
+	type Node struct {
+		Location *Location
+		Backup   *Location
+		Optional *Location `eon:",omitempty"`
+		Port     *int
+		Custom   ptrMarshaler
+		Meta     interface{}
+		Extra    interface{}
+		Nested   map[string]interface{}
+	}
+	port := 9000
+	v := &Node{
+		Location: &Location{"London"},
+		Port:     &port,
+		Custom:   "custom",
+		Meta:     &Location{"Paris"},
+		Nested: map[string]interface{}{
+			"list":   []interface{}{1, "two", nil},
+			"nested": map[string]interface{}{"x": true},
+			"nil":    nil,
+		},
+	}
+	expect := `location {
+	area = "London"
+}
+backup = null
+port = 9000
+custom = "CUSTOM"
+meta {
+	area = "Paris"
+}
+extra = null
+nested {
+	list = [1 "two" null]
+	nested {
+		x = true
+	}
+	nil = null
+}`
+	out, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error when encoding pointers: %s", err)
+	}
+	if expect != string(out) {
+		t.Errorf("mismatching encoded value for pointers:\nexpected:\n%s\ngot:\n%s", expect, out)
+	}
+	var got Node
+	if err := Unmarshal(out, &got); err != nil {
+		t.Fatalf("unexpected error when decoding pointers: %s", err)
+	}
+	if got.Location == nil || *got.Location != *v.Location || got.Backup != nil || *got.Port != port {
+		t.Errorf("mismatching round-tripped pointers: got %#v", got)
+	}
+	for _, elem := range []struct {
+		v      interface{}
+		expect string
+	}{
+		{(*int)(nil), "null"},
+		{ptrMarshaler("x"), `"X"`},
+		{(*dummyMarshaler)(nil), "null"},
+		{[]interface{}{ptrMarshaler("y"), &port}, `["Y" 9000]`},
+	} {
+		out, err := Marshal(elem.v)
+		if err != nil {
+			t.Errorf("unexpected error when encoding %#v: %s", elem.v, err)
+			continue
+		}
+		if elem.expect != string(out) {
+			t.Errorf("mismatching encoded value for %#v: expected %q, got %q", elem.v, elem.expect, out)
+		}
+	}
 }
 
 func TestEncodeSlice(t *testing.T) {
@@ -360,6 +885,79 @@ func TestEncodeString(t *testing.T) {
 		}
 	}
 }
+func TestEncodeTime(t *testing.T) {
+	type elem struct {
+		v      time.Time
+		expect string
+	}
+	for _, elem := range []elem{
+		{time.Date(2018, 9, 1, 12, 30, 0, 0, time.UTC), "2018-09-01T12:30:00Z"},
+		{time.Date(2018, 9, 1, 12, 30, 0, 500000000, time.FixedZone("", 3600)), "2018-09-01T12:30:00.5+01:00"},
+		{time.Date(2018, 9, 1, 0, 0, 0, 1, time.FixedZone("", -9000)), "2018-09-01T00:00:00.000000001-02:30"},
+	} {
+		out, err := Marshal(elem.v)
+		if err != nil {
+			t.Errorf("unexpected error when encoding time %v: %s", elem.v, err)
+			continue
+		}
+		if elem.expect != string(out) {
+			t.Errorf("mismatching encoded value for time: expected %q, got %q", elem.expect, out)
+		}
+	}
+	out, err := Marshal(struct {
+		Created Date
+		Updated *time.Time
+		Version semver.Version
+	}{
+		Date{2018, time.September, 1},
+		&time.Time{},
+		semver.Version{Patch: 1},
+	})
+	if err != nil {
+		t.Fatalf("unexpected error when encoding struct with time fields: %s", err)
+	}
+	expect := "created = 2018-09-01\nupdated = 0001-01-01T00:00:00Z\nversion = 0.0.1"
+	if string(out) != expect {
+		t.Errorf("mismatching encoded value for struct with time fields: expected %q, got %q", expect, out)
+	}
+	_, err = Marshal(time.Date(10000, 1, 1, 0, 0, 0, 0, time.UTC))
+	if err == nil || !strings.Contains(err.Error(), "year 10000 outside of the range 0-9999") {
+		t.Errorf("mismatching error when encoding time with an out of range year: got %v", err)
+	}
+}
+
+func TestEncodeTextMarshaler(t *testing.T) {
+	type peer struct {
+		ID    testKey
+		Addr  net.IP
+		Stake *big.Int
+		Prev  *testKey
+		Keys  []testKey
+	}
+	v := peer{
+		ID:    testKey{"node", "1"},
+		Addr:  net.IPv4(10, 0, 0, 1),
+		Stake: new(big.Int).Lsh(big.NewInt(1), 80),
+		Keys:  []testKey{{"a", "b"}},
+	}
+	out, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error when encoding text marshalers: %s", err)
+	}
+	expect := `id = "node:1"
+addr = "10.0.0.1"
+stake = "1208925819614629174706176"
+prev = null
+keys = ["a:b"]`
+	if string(out) != expect {
+		t.Errorf("mismatching encoded value for text marshalers: expected %q, got %q", expect, out)
+	}
+	_, err = Marshal(net.IP{1, 2, 3})
+	if err == nil || !strings.Contains(err.Error(), "error calling MarshalText for type net.IP: address 010203: invalid IP address") {
+		t.Errorf("mismatching error when encoding invalid IP: got %v", err)
+	}
+}
+
 func TestEncodeUint32(t *testing.T) {
 	type elem struct {
 		v      uint32
@@ -414,3 +1012,124 @@ func TestEncodeUint64(t *testing.T) {
 		}
 	}
 }
+
+func TestEncodeVersion(t *testing.T) {
+	type elem struct {
+		v      semver.Version
+		expect string
+	}
+	for _, elem := range []elem{
+		{semver.Version{}, "0.0.0"},
+		{semver.Version{Major: 1, Minor: 4, Patch: 2}, "1.4.2"},
+		{semver.Version{Patch: 1, Prerelease: "rc.1", Build: "sha.5114f85"}, "0.0.1-rc.1+sha.5114f85"},
+	} {
+		out, err := Marshal(elem.v)
+		if err != nil {
+			t.Errorf("unexpected error when encoding version %v: %s", elem.v, err)
+			continue
+		}
+		if elem.expect != string(out) {
+			t.Errorf("mismatching encoded value for version: expected %q, got %q", elem.expect, out)
+		}
+	}
+	_, err := Marshal(semver.Version{Prerelease: "beta 1"})
+	if err == nil || !strings.Contains(err.Error(), `cannot encode version 0.0.0-beta 1: invalid pre-release "beta 1"`) {
+		t.Errorf("mismatching error when encoding an invalid version: got %v", err)
+	}
+}
+
+func TestEncodeStruct(t *testing.T) {
+	type Base struct {
+		ID   int
+		Name string
+	}
+	type Location struct {
+		Area    string
+		Country string
+	}
+	type Node struct {
+		Base
+		NodeIPAddress string
+		Name          string `eon:"display-name"`
+		Port          int    `eon:",omitempty"`
+		Location      Location
+		Origin        Location `eon:",inline"`
+		Labels        []string
+		Peers         []Base
+		Empty         struct{}
+		Quoted        string `eon:"has space"`
+		Skipped       string `eon:"-"`
+		private       string
+	}
+	v := Node{
+		Base:          Base{ID: 7, Name: "hidden"},
+		NodeIPAddress: "10.0.0.1",
+		Name:          "tav",
+		Location:      Location{"London", "GB"},
+		Origin:        Location{"Paris", "FR"},
+		Labels:        []string{"a", "b"},
+		Peers:         []Base{{1, "x"}, {2, "y"}},
+		Quoted:        "q",
+		Skipped:       "skipped",
+		private:       "private",
+	}
+	expect := `id = 7
+name = "hidden"
+node-ip-address = "10.0.0.1"
+display-name = "tav"
+location {
+	area = "London"
+	country = "GB"
+}
+origin = {area = "Paris", country = "FR"}
+labels = ["a" "b"]
+peers = [{id = 1, name = "x"} {id = 2, name = "y"}]
+empty {}
+"has space" = "q"`
+	out, err := Marshal(v)
+	if err != nil {
+		t.Fatalf("unexpected error when encoding struct: %s", err)
+	}
+	if expect != string(out) {
+		t.Errorf("mismatching encoded value for struct:\nexpected:\n%s\ngot:\n%s", expect, out)
+	}
+	var got Node
+	if err := Unmarshal(out, &got); err != nil {
+		t.Fatalf("unexpected error when decoding encoded struct: %s", err)
+	}
+	v.Skipped = ""
+	v.private = ""
+	if !reflect.DeepEqual(v, got) {
+		t.Errorf("mismatching round-tripped struct: expected %#v, got %#v", v, got)
+	}
+}
+
+func TestEncodeStructEmbedded(t *testing.T) {
+	type A struct {
+		Name string
+		X    int
+	}
+	type B struct {
+		Name string
+		X    int `eon:"x"`
+	}
+	type C struct {
+		*A
+		B
+		Y int
+	}
+	out, err := Marshal(C{A: &A{Name: "a", X: 1}, B: B{Name: "b", X: 2}, Y: 3})
+	if err != nil {
+		t.Fatalf("unexpected error when encoding embedded structs: %s", err)
+	}
+	if expect := "x = 2\ny = 3"; expect != string(out) {
+		t.Errorf("mismatching encoded value for embedded structs: expected %q, got %q", expect, out)
+	}
+	out, err = Marshal(C{Y: 3})
+	if err != nil {
+		t.Fatalf("unexpected error when encoding nil embedded pointer: %s", err)
+	}
+	if expect := "x = 0\ny = 3"; expect != string(out) {
+		t.Errorf("mismatching encoded value for nil embedded pointer: expected %q, got %q", expect, out)
+	}
+}
@@ -4,47 +4,272 @@
 // Package eon implements encoding and decoding of EON (Extensible Object
 // Notation) data. The mapping between EON and Go values are documented in the
 // description of the Marshal and Unmarshal functions.
+//
+// Besides this static mode, where EON is mapped onto caller-provided Go types,
+// EON source can also be evaluated in dynamic mode with Eval, which produces a
+// tree of generic Values that can be inspected without a target type.
+//
+// For large inputs and outputs, an Encoder or Decoder can be used to stream a
+// sequence of documents, or of top-level entries, without holding all of them
+// in memory at once.
 package eon
 
 import (
 	"errors"
 )
 
-// Error values.
+// Error values. Errors for values nested within the value being encoded are
+// returned as a TypeError which wraps the error value, so errors.Is should be
+// used to check for them.
 var (
 	ErrFloatInf          = errors.New("eon: cannot encode Inf float value")
 	ErrFloatNaN          = errors.New("eon: cannot encode NaN float value")
 	ErrNilInterfaceValue = errors.New("eon: cannot encode nil interface value")
 )
 
+// MarshalOptions configures the layout of encoded EON. The zero value gives the
+// same layout as Marshal.
+type MarshalOptions struct {
+	// Canonical produces the canonical encoding, as per Canonicalize, for use
+	// when hashing or signing. All other options are ignored when it is set.
+	Canonical bool
+
+	// Comments holds the comments to write above entries, as per
+	// MarshalWithComments.
+	Comments map[string]string
+
+	// Indent is written once for each level of nesting, e.g. "  " for
+	// indenting with two spaces. It may only contain spaces and tabs, and
+	// defaults to a single tab.
+	Indent string
+
+	// LineWidth is the number of bytes, counting each indent at its length,
+	// past which lists that would extend beyond it are written with each of
+	// their elements on a separate line. Zero means that lists are always
+	// written on a single line, unless their field has the multiline option.
+	LineWidth int
+
+	// TrailingNewline ends non-empty output with a newline.
+	TrailingNewline bool
+}
+
+// Marshal returns the EON encoding of v, as per the top-level Marshal
+// function, but laid out according to the options.
+func (o MarshalOptions) Marshal(v interface{}) ([]byte, error) {
+	if o.Canonical {
+		out, err := marshal(v, &MarshalOptions{})
+		if err != nil {
+			return nil, err
+		}
+		return Canonicalize(out)
+	}
+	return marshal(v, &o)
+}
+
 // Marshaler is the interface implemented by types that can marshal themselves
 // into valid EON.
 type Marshaler interface {
 	MarshalEON(scratch []byte, opts EncodeOpts) ([]byte, error)
 }
 
+// RawValue is a raw EON-encoded value. It implements Marshaler and Unmarshaler,
+// so that it can be used to defer the decoding of part of a document, e.g. the
+// config section for a plugin, or to embed a precomputed encoding.
+//
+// When decoding, the RawValue is set to the exact source text of the value,
+// including any comments within it. A block is captured along with its braces,
+// so that the RawValue can itself be passed to Unmarshal. Template strings are
+// captured unresolved, and so can only reference keys within the RawValue.
+type RawValue []byte
+
+// MarshalEON returns r as the EON encoding of r. A nil or empty RawValue is
+// encoded as null.
+func (r RawValue) MarshalEON(scratch []byte, opts EncodeOpts) ([]byte, error) {
+	if len(r) == 0 {
+		return append(scratch, "null"...), nil
+	}
+	return r, nil
+}
+
+// UnmarshalEON sets *r to a copy of data.
+func (r *RawValue) UnmarshalEON(data []byte) error {
+	if r == nil {
+		return errors.New("eon: UnmarshalEON on nil pointer")
+	}
+	*r = append((*r)[0:0], data...)
+	return nil
+}
+
 // Unmarshaler is the interface implemented by types that can unmarshal an EON
-// description of themselves. UnmarshalEON must copy any of the data in the
-// given byte slice if it wishes to retain the data after returning.
+// description of themselves. The decoder calls UnmarshalEON with the exact
+// source text of the value, e.g. {\n\tname = "tav"\n} for a block, unless the
+// value is null, in which case the target is set to its zero value instead.
+// UnmarshalEON must copy any of the data in the given byte slice if it wishes
+// to retain the data after returning.
 type Unmarshaler interface {
 	UnmarshalEON([]byte) error
 }
 
+// Eval evaluates the EON-encoded data in dynamic mode and returns the resulting
+// Value. A top-level sequence of entries evaluates to a block.
+//
+// Template strings are evaluated to strings, with each ${...} interpolation
+// replaced by the textual form of its value. References within interpolations,
+// e.g. ${author.name}, are resolved against the innermost enclosing block that
+// defines the first key of the path, and may refer to keys defined later in the
+// document. A reference cycle results in an error. A literal ${ can be written
+// within a template by escaping the $ as \$.
+//
+// Functions can be called REBOL-style, with the name of the function followed
+// by its arguments, e.g. ${str.upper author.name}. Calls can be nested by
+// wrapping them in parentheses, and a call on its own line within a block is
+// run as a statement once all values have been evaluated, e.g.
+//
+//	print `${format} is ${days.since created} days old`
+//
+// Source that can't be parsed results in a SyntaxError, and problems found
+// while evaluating, e.g. references that can't be resolved, in a TypeError
+// carrying the key and position at which they were found.
+//
+// Eval resolves calls against the default builtins returned by NewBuiltins,
+// none of which perform any I/O. Hosts that want to provide other functions,
+// such as print, should register them with their own Builtins and use its Eval
+// method instead.
+func Eval(data []byte) (*Value, error) {
+	return eval(data, defaultBuiltins)
+}
+
 // Marshal returns the EON encoding of v.
 //
-// EON cannot represent cyclic data structures and Marshal does not handle them.
-// Passing cyclic structures to Marshal will result in an infinite recursion.
+// Structs are encoded as a sequence of `key = value` entries, with nested
+// structs encoded as `key { ... }` blocks. A top-level struct is encoded without
+// any enclosing braces. Only exported fields are encoded, in declaration order,
+// with the key defaulting to the slugified form of the field name, e.g. the
+// field NodeIPAddress is encoded with the key node-ip-address.
+//
+// The encoding of each struct field can be customized by the format string
+// stored under the "eon" key in the struct field's tag. The format string gives
+// the key for the field, possibly followed by a comma-separated list of
+// options. The key may be empty in order to specify options without overriding
+// the default key. The supported options are:
+//
+//	omitempty  omit the field if it has an empty value, i.e. false, 0, a nil
+//	           pointer or interface value, or an empty array, slice, map or
+//	           string
+//	inline     encode the value on a single line, e.g. {area = "London"}
+//	multiline  encode lists with each element on a separate line, and
+//	           strings as multiline literals
+//	hex        encode byte slices as hex"..." literals instead of b64"..."
+//	required   when decoding, report the key as missing if it isn't present
+//
+// As a special case, if the field tag is "-", the field is always omitted.
+//
+// The fields of embedded structs are flattened into the outer struct, following
+// the same visibility rules as encoding/json.
+//
+// Pointer values encode as the value pointed to, and interface values encode as
+// the value contained in the interface. A nil pointer or interface value
+// encodes as null, unless it is a struct field with the omitempty option, in
+// which case it is omitted.
+//
+// Slices and arrays are encoded as lists, on a single line unless the field has
+// the multiline option, or the list would extend past the LineWidth set in the
+// MarshalOptions. Byte slices and byte arrays are encoded as binary literals
+// instead, e.g. b64"AQID" using standard base64 encoding, or hex"010203" if the
+// field has the hex option.
+//
+// Strings containing newlines are encoded as multiline literals delimited by
+// """ on their own lines, with the content indented one level deeper than the
+// key. Their content is preserved exactly, including any trailing newline.
+//
+// Values of type time.Duration and bytesize.Value are encoded as unquoted
+// duration and byte size literals, e.g. 5h27m0s and 20GB.
+//
+// Date values are encoded as unquoted date literals, e.g. 2018-09-01, and
+// time.Time values as unquoted RFC 3339 timestamps, e.g. 2018-09-01T12:30:00Z,
+// which retain the time's UTC offset and any fractional seconds. Times and dates
+// outside of the years 0 to 9999, as well as invalid dates, result in an error.
+//
+// Values of type semver.Version are encoded as unquoted version literals, e.g.
+// 1.4.2-beta.1+build.7.
+//
+// If a value, or a pointer to it, implements Marshaler, then its MarshalEON
+// method is called to produce the encoding. Otherwise, if it implements
+// encoding.TextMarshaler, then the output of its MarshalText method is encoded
+// as a string. This takes precedence over the default encoding for the value's
+// kind, e.g. net.IP values are encoded as strings rather than binary literals,
+// with the exception of time.Time values, which are always encoded as
+// timestamps.
+//
+// EON cannot represent cyclic data structures. Marshal detects them and returns
+// a TypeError naming the type and key path at which the cycle begins.
+//
+// Values that can't be encoded, e.g. NaN floats or invalid dates, result in a
+// TypeError naming the key path and Go type of the value.
 func Marshal(v interface{}) ([]byte, error) {
-	return marshal(v, nil)
+	return marshal(v, &MarshalOptions{})
 }
 
 // MarshalWithComments is like Marshal but includes the given comment headers.
+// The comments map is keyed by the dotted path to an entry, e.g. author.name,
+// and each comment is written as // lines directly above the entry's key. The
+// comment for the empty path is written at the top of the output, followed by
+// a blank line. Entries within inline values can't have comments, so any
+// comments for them are ignored.
 func MarshalWithComments(v interface{}, comments map[string]string) ([]byte, error) {
-	return marshal(v, comments)
+	return marshal(v, &MarshalOptions{Comments: comments})
 }
 
 // Unmarshal parses the EON-encoded data and stores the result in the value
-// pointed to by v.
+// pointed to by v. If v is nil or not a pointer, Unmarshal returns an error.
+//
+// Blocks are decoded into structs and maps with string keys, lists into slices,
+// and literals into the Go value of the matching kind. Struct fields are
+// matched against the key named in their `eon` tag, or otherwise against the
+// slugified form of the field name, e.g. NodeID is matched by the key node-id.
+// Keys that do not match any field are ignored, and if a key appears more than
+// once in a block, the last value is used. A Decoder can be set to reject both
+// instead. When decoding into an interface value, blocks become
+// map[string]interface{}, lists become []interface{}, and numeric literals
+// become int64 or float64 values. Binary literals are decoded into byte slices
+// and byte arrays, or []byte values when decoding into an interface value. When
+// decoding into an array, the number of list elements or bytes must match the
+// length of the array.
+//
+// Duration and byte size literals are decoded into time.Duration and
+// bytesize.Value values respectively. Plain integers are also accepted for
+// these types, as a number of nanoseconds or bytes. Literals with an unknown
+// unit, e.g. 20XB, are rejected when parsing.
+//
+// Date literals are decoded into Date values, and both date and timestamp
+// literals into time.Time values. Timestamps keep their UTC offset, while dates
+// are decoded as midnight UTC on that day. Dates and timestamps that don't exist
+// in the calendar, e.g. 2018-02-30, are rejected when parsing. When decoding
+// into an interface value, dates and timestamps become strings.
+//
+// Version literals, which follow the Semantic Versioning 2.0.0 specification,
+// are decoded into semver.Version values, or into strings when decoding into an
+// interface value. Invalid versions, e.g. 1.0.01, are rejected when parsing.
+//
+// If a pointer to the target implements Unmarshaler, then its UnmarshalEON
+// method is called with the raw source text of the value. Otherwise, if it
+// implements encoding.TextUnmarshaler, then a string value is decoded by
+// passing it to the target's UnmarshalText method, with the same exception for
+// time.Time as in Marshal.
+//
+// Template strings are resolved in the same way as by Eval, so they may
+// reference other keys in the document and call the default builtins. Call
+// statements are only supported by Eval, and result in an error.
+//
+// A null value sets the target to its zero value.
+//
+// If the block for a struct lacks the key of a field with the required option,
+// Unmarshal returns a KeyErrors value listing every missing key, once the rest
+// of the value has been decoded.
+//
+// Source that can't be parsed results in a SyntaxError, and values that can't
+// be decoded into the target result in a TypeError. Both carry the line and
+// column of the problem, so that it can be pointed out in the source.
 func Unmarshal(data []byte, v interface{}) error {
-	return nil
+	return unmarshal(data, v)
 }
@@ -0,0 +1,115 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// KeyError describes a problem with a key that was found when decoding, e.g.
+// an unknown key when unknown keys are disallowed, or a missing required key.
+// The position is that of the key, or for a missing key, that of the block
+// which should have contained it.
+type KeyError struct {
+	Col    int
+	File   string
+	Key    string
+	Line   int
+	Reason string
+}
+
+func (e *KeyError) Error() string {
+	return fmt.Sprintf("eon: %s %s %s", e.Reason, e.Key, position(e.File, e.Line, e.Col))
+}
+
+// KeyErrors lists every problem with keys that was found when decoding a
+// value, ordered by their position in the source.
+type KeyErrors []*KeyError
+
+// Error returns the message of the first problem, along with the number of
+// further problems, if any.
+func (e KeyErrors) Error() string {
+	switch len(e) {
+	case 0:
+		return "eon: no key errors"
+	case 1:
+		return e[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", e[0], len(e)-1)
+}
+
+// SyntaxError describes EON source that can't be parsed, including literals
+// with invalid values, e.g. the date 2018-02-30. Line and Col give the
+// position of the offending token, counting from 1, and File is set to the
+// name of the source if it is known.
+type SyntaxError struct {
+	Col  int
+	File string
+	Line int
+	Msg  string
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("eon: syntax error %s: %s", position(e.File, e.Line, e.Col), e.Msg)
+}
+
+// TypeError describes an EON value that can't be decoded into a Go value, or a
+// Go value that can't be encoded as EON.
+//
+// Key is the dotted path to the value, e.g. author.location.country, and is
+// empty for the top-level value. Type is the Go type involved, where there is
+// one. When decoding, Line and Col give the position of the value within the
+// source, and File is set to the name of the source if it is known. Encoding
+// errors have no position.
+//
+// Where the error corresponds to one of the package's error values, e.g.
+// ErrFloatNaN, Err is set to it, so that it can be matched with errors.Is.
+type TypeError struct {
+	Col  int
+	Err  error
+	File string
+	Key  string
+	Line int
+	Msg  string
+	Type reflect.Type
+}
+
+func (e *TypeError) Error() string {
+	msg := "eon: " + e.Msg
+	if e.Key != "" {
+		msg += " for key " + e.Key
+	}
+	if e.Line > 0 {
+		msg += " " + position(e.File, e.Line, e.Col)
+	}
+	return msg
+}
+
+// Unwrap returns the underlying error value, if any.
+func (e *TypeError) Unwrap() error {
+	return e.Err
+}
+
+func position(file string, line int, col int) string {
+	if file == "" {
+		return fmt.Sprintf("at line %d, col %d", line, col)
+	}
+	return fmt.Sprintf("in %s at line %d, col %d", file, line, col)
+}
+
+// withFile sets the name of the source on any of the positioned error types.
+func withFile(err error, file string) error {
+	switch err := err.(type) {
+	case KeyErrors:
+		for _, kerr := range err {
+			kerr.File = file
+		}
+	case *SyntaxError:
+		err.File = file
+	case *TypeError:
+		err.File = file
+	}
+	return err
+}
@@ -0,0 +1,92 @@
+package eon
+
+import (
+	"errors"
+	"math"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSyntaxError(t *testing.T) {
+	type elem struct {
+		src  string
+		line int
+		col  int
+		msg  string
+	}
+	for _, elem := range []elem{
+		{"a = 1\nb = [1 2", 2, 9, "unexpected end of input, expected ']'"},
+		{"a = \"x", 1, 7, "unterminated string literal"},
+		{"a {\n\tb = 2018-02-30\n}", 2, 6, "invalid date 2018-02-30: day out of range"},
+		{"a = 20XB", 1, 7, `unknown unit "XB" in literal "20XB"`},
+	} {
+		var v map[string]interface{}
+		err := Unmarshal([]byte(elem.src), &v)
+		var serr *SyntaxError
+		if !errors.As(err, &serr) {
+			t.Errorf("expected SyntaxError when decoding %q, got %v", elem.src, err)
+			continue
+		}
+		if serr.Line != elem.line || serr.Col != elem.col || serr.Msg != elem.msg {
+			t.Errorf("mismatching SyntaxError when decoding %q: expected %d:%d %q, got %d:%d %q", elem.src, elem.line, elem.col, elem.msg, serr.Line, serr.Col, serr.Msg)
+		}
+	}
+	dec := NewDecoder(strings.NewReader("a = 1\n---\na = [\n"))
+	dec.SetFile("peers.eon")
+	var v struct{ A int }
+	if err := dec.Decode(&v); err != nil {
+		t.Fatalf("unexpected error when decoding first document: %s", err)
+	}
+	expect := "eon: syntax error in peers.eon at line 4, col 1: unexpected end of input, expected ']'"
+	if err := dec.Decode(&v); err == nil || err.Error() != expect {
+		t.Errorf("mismatching error with file name: expected %q, got %v", expect, err)
+	}
+}
+
+func TestTypeError(t *testing.T) {
+	type location struct {
+		Country int
+	}
+	var v struct {
+		Author struct {
+			Location location
+		}
+	}
+	src := "author {\n\tlocation {\n\t\tcountry = \"UK\"\n\t}\n}"
+	err := Unmarshal([]byte(src), &v)
+	var terr *TypeError
+	if !errors.As(err, &terr) {
+		t.Fatalf("expected TypeError when decoding mismatching value, got %v", err)
+	}
+	if terr.Key != "author.location.country" || terr.Line != 3 || terr.Col != 13 || terr.Type != reflect.TypeOf(0) {
+		t.Errorf("mismatching TypeError fields: got %+v", terr)
+	}
+	expect := "eon: cannot decode string into value of type int for key author.location.country at line 3, col 13"
+	if err.Error() != expect {
+		t.Errorf("mismatching error for TypeError: expected %q, got %q", expect, err)
+	}
+	type elem struct {
+		v   interface{}
+		err error
+		key string
+		msg string
+	}
+	for _, elem := range []elem{
+		{map[string]float64{"a": math.Inf(1)}, ErrFloatInf, "a", "eon: cannot encode Inf float value for key a"},
+		{struct{ B []float32 }{[]float32{float32(math.NaN())}}, ErrFloatNaN, "b", "eon: cannot encode NaN float value for key b"},
+		{struct{ C Date }{Date{2018, 2, 30}}, nil, "c", "eon: cannot encode invalid date 2018-02-30 for key c"},
+	} {
+		_, err := Marshal(elem.v)
+		if !errors.As(err, &terr) {
+			t.Errorf("expected TypeError when encoding %#v, got %v", elem.v, err)
+			continue
+		}
+		if elem.err != nil && !errors.Is(err, elem.err) {
+			t.Errorf("expected error when encoding %#v to match %v", elem.v, elem.err)
+		}
+		if terr.Key != elem.key || err.Error() != elem.msg {
+			t.Errorf("mismatching error when encoding %#v: expected %q, got %q", elem.v, elem.msg, err)
+		}
+	}
+}
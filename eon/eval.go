@@ -0,0 +1,366 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var valueKinds = map[nodeKind]Kind{
+	nodeBinary:    KindBinary,
+	nodeBool:      KindBool,
+	nodeByteSize:  KindByteSize,
+	nodeDate:      KindDate,
+	nodeDuration:  KindDuration,
+	nodeNull:      KindNull,
+	nodeNumber:    KindNumber,
+	nodeString:    KindString,
+	nodeTimestamp: KindTimestamp,
+	nodeVersion:   KindVersion,
+}
+
+// estate holds the state of an evaluation in dynamic mode.
+//
+// Templates are resolved lazily, so that they can reference keys defined
+// anywhere in the document, including those defined after them. The resolved
+// value of each template is cached, and the templates that are currently being
+// resolved are tracked in order to detect reference cycles. Calls are resolved
+// against the given builtins.
+type estate struct {
+	active    map[*node]bool
+	builtins  *Builtins
+	cache     map[*node]string
+	path      []string
+	refs      []string
+	resolving int
+	scanned   bool
+	root      *node
+	scopes    map[*node][]*node
+}
+
+// call evaluates a call to a builtin. References without any arguments are
+// also called when they name a builtin but can't be resolved to a key.
+func (e *estate) call(n *node, scopes []*node) (*Value, error) {
+	fn := e.builtins.Lookup(n.text)
+	if fn == nil {
+		return nil, e.errorf(n, "cannot call unknown function %s", n.text)
+	}
+	args := make([]*Value, len(n.elems))
+	for i, elem := range n.elems {
+		arg, err := e.value(elem, scopes)
+		if err != nil {
+			return nil, err
+		}
+		args[i] = arg
+	}
+	if err := e.check(n, fn, args); err != nil {
+		return nil, err
+	}
+	res, err := fn.Func(args)
+	if err == nil {
+		var v *Value
+		if v, err = valueOf(res, n); err == nil {
+			return v, nil
+		}
+	}
+	// Errors from the Value accessors already include the position of the
+	// offending argument.
+	if terr, ok := err.(*TypeError); ok {
+		return nil, &TypeError{
+			Col:  terr.Col,
+			Err:  terr.Err,
+			Key:  terr.Key,
+			Line: terr.Line,
+			Msg:  "call to " + n.text + " failed: " + terr.Msg,
+			Type: terr.Type,
+		}
+	}
+	return nil, e.errorf(n, "call to %s failed: %s", n.text, err)
+}
+
+// check validates the arguments to a call against the parameters of the
+// builtin being called.
+func (e *estate) check(call *node, fn *Builtin, args []*Value) error {
+	n := len(fn.Params)
+	if fn.Variadic {
+		if len(args) < n-1 {
+			return e.errorf(call, "%s expects at least %s, got %d", call.text, countArgs(n-1), len(args))
+		}
+	} else if len(args) != n {
+		return e.errorf(call, "%s expects %s, got %d", call.text, countArgs(n), len(args))
+	}
+	if n == 0 {
+		// Variadic builtins without any Params accept arguments of any kind.
+		return nil
+	}
+	for i, arg := range args {
+		param := i
+		if param >= n {
+			param = n - 1
+		}
+		if kind := fn.Params[param]; kind != 0 && arg.kind != kind {
+			return e.errorf(call.elems[i], "argument %d to %s must be a %s, got %s", i+1, call.text, kind, arg.kind)
+		}
+	}
+	return nil
+}
+
+// errorf returns a TypeError for the given node at the current path.
+func (e *estate) errorf(n *node, format string, args ...interface{}) error {
+	return &TypeError{
+		Col:  n.col,
+		Key:  strings.Join(e.path, "."),
+		Line: n.line,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (e *estate) eval(n *node) (*Value, error) {
+	v := &Value{
+		col:  n.col,
+		key:  strings.Join(e.path, "."),
+		line: n.line,
+		text: n.text,
+	}
+	switch n.kind {
+	case nodeBlock:
+		v.kind = KindBlock
+		v.values = make(map[string]*Value, len(n.entries))
+		// Blocks that are being resolved as the target of a reference are
+		// evaluated without extending the path, so that errors are reported
+		// for the key of the template or call that referenced them.
+		track := e.resolving == 0
+		for _, entry := range n.entries {
+			if track {
+				e.path = append(e.path, entry.key)
+			}
+			elem, err := e.eval(entry.value)
+			if err != nil {
+				return nil, err
+			}
+			if track {
+				e.path = e.path[:len(e.path)-1]
+			}
+			if _, ok := v.values[entry.key]; !ok {
+				v.keys = append(v.keys, entry.key)
+			}
+			v.values[entry.key] = elem
+		}
+	case nodeList:
+		v.kind = KindList
+		v.elems = make([]*Value, len(n.elems))
+		for i, elem := range n.elems {
+			ev, err := e.eval(elem)
+			if err != nil {
+				return nil, err
+			}
+			v.elems[i] = ev
+		}
+	case nodeTemplate:
+		s, err := e.template(n)
+		if err != nil {
+			return nil, err
+		}
+		v.kind = KindString
+		v.text = s
+	default:
+		kind, ok := valueKinds[n.kind]
+		if !ok {
+			return nil, e.errorf(n, "cannot evaluate %s", n.describe())
+		}
+		v.kind = kind
+	}
+	return v, nil
+}
+
+// exec runs the call statements within the given node in the order that they
+// appear in the source.
+func (e *estate) exec(n *node, scopes []*node) error {
+	switch n.kind {
+	case nodeBlock:
+		scopes = append(scopes[:len(scopes):len(scopes)], n)
+		calls := n.calls
+		for _, entry := range n.entries {
+			for len(calls) > 0 && calls[0].start < entry.start {
+				if _, err := e.call(calls[0], scopes); err != nil {
+					return err
+				}
+				calls = calls[1:]
+			}
+			e.path = append(e.path, entry.key)
+			if err := e.exec(entry.value, scopes); err != nil {
+				return err
+			}
+			e.path = e.path[:len(e.path)-1]
+		}
+		for _, call := range calls {
+			if _, err := e.call(call, scopes); err != nil {
+				return err
+			}
+		}
+	case nodeList:
+		for _, elem := range n.elems {
+			if err := e.exec(elem, scopes); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// resolve returns the node that the given reference points to. The first key
+// of the reference is looked up in the innermost enclosing block that defines
+// it, so that keys in the same block can be referenced without their full path.
+func (e *estate) resolve(ref *node, scopes []*node) (*node, error) {
+	keys := strings.Split(ref.text, ".")
+	for i := len(scopes) - 1; i >= 0; i-- {
+		entry := lastEntry(scopes[i], keys[0])
+		if entry == nil {
+			continue
+		}
+		n := entry.value
+		for j, key := range keys[1:] {
+			if n.kind != nodeBlock {
+				return nil, e.errorf(ref, "cannot resolve %s as %s is not a block", ref.text, strings.Join(keys[:j+1], "."))
+			}
+			if entry = lastEntry(n, key); entry == nil {
+				return nil, e.errorf(ref, "cannot resolve %s", ref.text)
+			}
+			n = entry.value
+		}
+		return n, nil
+	}
+	return nil, e.errorf(ref, "cannot resolve %s", ref.text)
+}
+
+// scan records the enclosing blocks of every template within the given node,
+// including those passed as arguments to call statements.
+func (e *estate) scan(n *node, scopes []*node) {
+	switch n.kind {
+	case nodeBlock:
+		scopes = append(scopes[:len(scopes):len(scopes)], n)
+		for _, entry := range n.entries {
+			e.scan(entry.value, scopes)
+		}
+		for _, call := range n.calls {
+			e.scan(call, scopes)
+		}
+	case nodeCall, nodeList:
+		for _, elem := range n.elems {
+			e.scan(elem, scopes)
+		}
+	case nodeTemplate:
+		e.scopes[n] = scopes
+		for _, elem := range n.elems {
+			e.scan(elem, scopes)
+		}
+	}
+}
+
+// template returns the resolved value of a template string.
+func (e *estate) template(n *node) (string, error) {
+	if s, ok := e.cache[n]; ok {
+		return s, nil
+	}
+	if !e.scanned {
+		e.active = map[*node]bool{}
+		e.cache = map[*node]string{}
+		e.scopes = map[*node][]*node{}
+		e.scan(e.root, nil)
+		e.scanned = true
+	}
+	if e.active[n] {
+		// The template is being resolved already, as it's nested within the
+		// value of one of the references that it's in the middle of resolving.
+		return "", e.errorf(n, "reference cycle detected: %s", strings.Join(e.refs, " -> "))
+	}
+	if len(e.active) == 0 {
+		e.refs = e.refs[:0]
+		if len(e.path) > 0 {
+			e.refs = append(e.refs, strings.Join(e.path, "."))
+		}
+	}
+	e.active[n] = true
+	var buf strings.Builder
+	for _, part := range n.elems {
+		v, err := e.value(part, e.scopes[n])
+		if err != nil {
+			return "", err
+		}
+		s, err := v.Text()
+		if err != nil {
+			switch part.kind {
+			case nodeCall:
+				return "", e.errorf(part, "cannot interpolate %s returned by %s", v.kind, part.text)
+			case nodeRef:
+				return "", e.errorf(part, "cannot interpolate %s referenced by %s", v.kind, part.text)
+			}
+			return "", e.errorf(part, "cannot interpolate %s", v.kind)
+		}
+		buf.WriteString(s)
+	}
+	delete(e.active, n)
+	s := buf.String()
+	e.cache[n] = s
+	return s, nil
+}
+
+// value evaluates a part of a template or an argument to a call. References
+// are resolved within the given scopes.
+func (e *estate) value(n *node, scopes []*node) (*Value, error) {
+	switch n.kind {
+	case nodeCall:
+		return e.call(n, scopes)
+	case nodeRef:
+		target, err := e.resolve(n, scopes)
+		if err != nil {
+			if e.builtins.Lookup(n.text) != nil {
+				return e.call(n, scopes)
+			}
+			return nil, err
+		}
+		if e.active[target] {
+			refs := append(e.refs, n.text)
+			return nil, e.errorf(n, "reference cycle detected: %s", strings.Join(refs, " -> "))
+		}
+		e.refs = append(e.refs, n.text)
+		e.resolving++
+		v, err := e.eval(target)
+		if err != nil {
+			return nil, err
+		}
+		e.resolving--
+		e.refs = e.refs[:len(e.refs)-1]
+		return v, nil
+	}
+	return e.eval(n)
+}
+
+func countArgs(n int) string {
+	if n == 1 {
+		return "1 argument"
+	}
+	return strconv.Itoa(n) + " arguments"
+}
+
+func eval(data []byte, builtins *Builtins) (*Value, error) {
+	n, err := parse(data)
+	if err != nil {
+		return nil, err
+	}
+	e := &estate{
+		builtins: builtins,
+		root:     n,
+	}
+	v, err := e.eval(n)
+	if err != nil {
+		return nil, err
+	}
+	if err := e.exec(n, nil); err != nil {
+		return nil, err
+	}
+	return v, nil
+}
@@ -0,0 +1,362 @@
+package eon
+
+import (
+	"bytes"
+	"errors"
+	"io/ioutil"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"peerbase.net/go/bytesize"
+	"peerbase.net/go/semver"
+)
+
+func TestEval(t *testing.T) {
+	src := `format = "EON"
+created = 2018-09-01
+version = 0.0.1
+timeout = 1m30s
+max-size = 20GB
+key = hex"cafe"
+debug = false
+parent = null
+author {
+	name = "tav"
+	addictions = ["Gauloises", "Nutella"]
+	age = 42
+	ratio = 0.5
+}
+note = ` + "`plain`" + `
+updated = 2018-09-01T12:30:00+01:00`
+	v, err := Eval([]byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error when evaluating: %s", err)
+	}
+	if v.Kind() != KindBlock {
+		t.Fatalf("unexpected kind for top-level value: %s", v.Kind())
+	}
+	expect := []string{"format", "created", "version", "timeout", "max-size", "key", "debug", "parent", "author", "note", "updated"}
+	if !reflect.DeepEqual(expect, v.Keys()) {
+		t.Errorf("mismatching keys: expected %v, got %v", expect, v.Keys())
+	}
+	type elem struct {
+		path   string
+		kind   Kind
+		get    func(*Value) (interface{}, error)
+		expect interface{}
+	}
+	for _, elem := range []elem{
+		{"format", KindString, func(v *Value) (interface{}, error) { return v.Text() }, "EON"},
+		{"created", KindDate, func(v *Value) (interface{}, error) { return v.Date() }, Date{2018, time.September, 1}},
+		{"created", KindDate, func(v *Value) (interface{}, error) { return v.Time() }, time.Date(2018, 9, 1, 0, 0, 0, 0, time.UTC)},
+		{"version", KindVersion, func(v *Value) (interface{}, error) { return v.Version() }, semver.Version{Patch: 1}},
+		{"timeout", KindDuration, func(v *Value) (interface{}, error) { return v.Duration() }, 90 * time.Second},
+		{"max-size", KindByteSize, func(v *Value) (interface{}, error) { return v.ByteSize() }, bytesize.Value(20 * bytesize.GB)},
+		{"key", KindBinary, func(v *Value) (interface{}, error) { return v.Bytes() }, []byte{0xca, 0xfe}},
+		{"debug", KindBool, func(v *Value) (interface{}, error) { return v.Bool() }, false},
+		{"author.name", KindString, func(v *Value) (interface{}, error) { return v.Text() }, "tav"},
+		{"author.age", KindNumber, func(v *Value) (interface{}, error) { return v.Int() }, int64(42)},
+		{"author.ratio", KindNumber, func(v *Value) (interface{}, error) { return v.Float() }, 0.5},
+		{"note", KindString, func(v *Value) (interface{}, error) { return v.Text() }, "plain"},
+		{"updated", KindTimestamp, func(v *Value) (interface{}, error) { return v.Time() }, time.Date(2018, 9, 1, 12, 30, 0, 0, time.FixedZone("", 3600))},
+	} {
+		ev := v.Lookup(elem.path)
+		if ev == nil {
+			t.Errorf("unable to find value for %s", elem.path)
+			continue
+		}
+		if ev.Kind() != elem.kind {
+			t.Errorf("mismatching kind for %s: expected %s, got %s", elem.path, elem.kind, ev.Kind())
+			continue
+		}
+		got, err := elem.get(ev)
+		if err != nil {
+			t.Errorf("unexpected error when accessing %s: %s", elem.path, err)
+			continue
+		}
+		if !reflect.DeepEqual(elem.expect, got) {
+			t.Errorf("mismatching value for %s: expected %#v, got %#v", elem.path, elem.expect, got)
+		}
+	}
+	if ev := v.Lookup("parent"); ev == nil || ev.Kind() != KindNull {
+		t.Errorf("expected a null value for parent, got %v", ev)
+	}
+	list, err := v.Lookup("author.addictions").List()
+	if err != nil {
+		t.Fatalf("unexpected error when accessing list: %s", err)
+	}
+	if len(list) != 2 || list[1].Line() != 11 || list[1].Col() != 29 {
+		t.Errorf("unexpected list elements: %+v", list)
+	}
+	for _, path := range []string{"missing", "author.missing", "format.name"} {
+		if ev := v.Lookup(path); ev != nil {
+			t.Errorf("expected nil value when looking up %s, got %+v", path, ev)
+		}
+	}
+	got := v.Lookup("author").Interface()
+	expectAuthor := map[string]interface{}{
+		"name":       "tav",
+		"addictions": []interface{}{"Gauloises", "Nutella"},
+		"age":        int64(42),
+		"ratio":      0.5,
+	}
+	if !reflect.DeepEqual(expectAuthor, got) {
+		t.Errorf("mismatching interface value: expected %#v, got %#v", expectAuthor, got)
+	}
+}
+
+func TestEvalAuthors(t *testing.T) {
+	src, err := ioutil.ReadFile("../AUTHORS.eon")
+	if err != nil {
+		t.Fatalf("unable to read AUTHORS.eon: %s", err)
+	}
+	v, err := Eval(src)
+	if err != nil {
+		t.Fatalf("unexpected error when evaluating AUTHORS.eon: %s", err)
+	}
+	country, err := v.Lookup("tav.location.country").Text()
+	if err != nil {
+		t.Fatalf("unexpected error when accessing country: %s", err)
+	}
+	if country != "GB" {
+		t.Errorf("mismatching country: expected %q, got %q", "GB", country)
+	}
+}
+
+func TestEvalCallErrors(t *testing.T) {
+	type elem struct {
+		src    string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"a = `${str.upper}`", "str.upper expects 1 argument, got 0 for key a at line 1, col 8"},
+		{"a = `${str.replace \"x\" \"y\"}`", "str.replace expects 3 arguments, got 2 for key a at line 1, col 8"},
+		{"a = `${math.max}`", "math.max expects at least 1 argument, got 0 for key a at line 1, col 8"},
+		{"a = `${str.upper 42}`", "argument 1 to str.upper must be a string, got number for key a at line 1, col 18"},
+		{"a = `${math.min 1 2 \"x\"}`", "argument 3 to math.min must be a number, got string for key a at line 1, col 21"},
+		{"a = `${days.since (str.upper \"x\")}`", "argument 1 to days.since must be a date, got string for key a at line 1, col 20"},
+		{"a = `${foo.bar 1}`", "cannot call unknown function foo.bar for key a at line 1, col 8"},
+		{"a = `${str.split \"a,b\" \",\"}`", "cannot interpolate list returned by str.split for key a at line 1, col 8"},
+		{"a = `${str.upper b}`\nb = `${a}`", "reference cycle detected: a -> b -> a for key a at line 2, col 8"},
+		{"a {\n\tprint 1\n}", "cannot call unknown function print for key a at line 2, col 2"},
+		{"print (str.upper 1", "unexpected end of input, expected ')'"},
+	} {
+		_, err := Eval([]byte(elem.src))
+		if err == nil {
+			t.Errorf("failed to receive expected error when evaluating %q", elem.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), elem.expect) {
+			t.Errorf("mismatching error when evaluating %q: expected %q, got %q", elem.src, elem.expect, err)
+		}
+	}
+}
+
+func TestEvalCalls(t *testing.T) {
+	src := "created = 2018-09-01\n" +
+		"author {\n" +
+		"\tname = \"tav\"\n" +
+		"\taddictions = [\"Gauloises\", \"Nutella\"]\n" +
+		"\tprint `${str.upper name} is addicted to ${str.join addictions \", \"}`\n" +
+		"}\n" +
+		"age = `${days.since created}`\n" +
+		"max = `${math.max 3 -7.5 (math.abs -12)}`\n" +
+		"trim = `[${str.trim (str.replace \"  a-b  \" \"-\" \"+\")}]`\n" +
+		"print `${author.name} is ${age} days old` `(${max})`\n" +
+		"print 1; print 2.5s\n"
+	var buf bytes.Buffer
+	builtins := NewBuiltins()
+	builtins.now = func() time.Time {
+		return time.Date(2018, 9, 11, 12, 0, 0, 0, time.UTC)
+	}
+	builtins.Register("print", PrintBuiltin(&buf))
+	v, err := builtins.Eval([]byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error when evaluating calls: %s", err)
+	}
+	type elem struct {
+		path   string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"age", "10"},
+		{"max", "12"},
+		{"trim", "[a+b]"},
+	} {
+		got, err := v.Lookup(elem.path).Text()
+		if err != nil {
+			t.Errorf("unexpected error when accessing %s: %s", elem.path, err)
+			continue
+		}
+		if got != elem.expect {
+			t.Errorf("mismatching value for %s: expected %q, got %q", elem.path, elem.expect, got)
+		}
+	}
+	expect := "TAV is addicted to Gauloises, Nutella\ntav is 10 days old (12)\n1\n2.5s\n"
+	_, err = builtins.Eval([]byte("print hex\"cafe\""))
+	if got := buf.String(); got != expect {
+		t.Errorf("mismatching printed output: expected %q, got %q", expect, got)
+	}
+	if err == nil || !strings.Contains(err.Error(), "call to print failed: cannot use binary value as text at line 1, col 7") {
+		t.Errorf("mismatching error when printing binary value: got %v", err)
+	}
+	if terr, ok := err.(*TypeError); !ok || terr.Line != 1 || terr.Col != 7 {
+		t.Errorf("expected TypeError at the position of the argument when printing binary value, got %#v", err)
+	}
+	if _, err := Eval([]byte("print 1")); err == nil {
+		t.Errorf("failed to receive error when calling print with the default builtins")
+	}
+	builtins.Register("count", &Builtin{
+		Func: func(args []*Value) (interface{}, error) {
+			return len(args), nil
+		},
+		Variadic: true,
+	})
+	v, err = builtins.Eval([]byte("a = `${count}`\nb = `${count 1 \"x\" [2]}`"))
+	if err != nil {
+		t.Fatalf("unexpected error when calling variadic builtin without params: %s", err)
+	}
+	for path, expect := range map[string]string{"a": "0", "b": "3"} {
+		if got, _ := v.Lookup(path).Text(); got != expect {
+			t.Errorf("mismatching value for %s: expected %q, got %q", path, expect, got)
+		}
+	}
+}
+
+func TestEvalErrors(t *testing.T) {
+	v, err := Eval([]byte("a = 1.5\nb {\n\tc = [1]\n}\nd = 12345678901234567890"))
+	if err != nil {
+		t.Fatalf("unexpected error when evaluating: %s", err)
+	}
+	_, boolErr := v.Lookup("a").Bool()
+	_, intErr := v.Lookup("a").Int()
+	_, textErr := v.Lookup("b.c").Text()
+	_, listErr := v.Lookup("b").List()
+	_, rangeErr := v.Lookup("d").Int()
+	_, evalErr := Eval([]byte("a {\n\tb = `x ${y}`\n}"))
+	_, syntaxErr := Eval([]byte("a = "))
+	for _, elem := range []struct {
+		err    error
+		expect string
+	}{
+		{boolErr, "cannot use number value as bool for key a at line 1, col 5"},
+		{intErr, "invalid int64 value 1.5 for key a at line 1, col 5"},
+		{textErr, "cannot use list value as text for key b.c at line 3, col 6"},
+		{listErr, "cannot use block value as list for key b at line 2, col 3"},
+		{rangeErr, "invalid int64 value 12345678901234567890"},
+		{evalErr, "cannot resolve y for key a.b at line 2, col 11"},
+		{syntaxErr, "syntax error"},
+	} {
+		if elem.err == nil {
+			t.Errorf("failed to receive expected error %q", elem.expect)
+			continue
+		}
+		if !strings.Contains(elem.err.Error(), elem.expect) {
+			t.Errorf("mismatching error: expected %q, got %q", elem.expect, elem.err)
+		}
+	}
+	var terr *TypeError
+	if !errors.As(evalErr, &terr) {
+		t.Fatalf("expected TypeError when evaluating unresolvable reference, got %v", evalErr)
+	}
+	if terr.Key != "a.b" || terr.Line != 2 || terr.Col != 11 {
+		t.Errorf("mismatching TypeError fields for unresolvable reference: got %+v", terr)
+	}
+	if !errors.As(textErr, &terr) {
+		t.Fatalf("expected TypeError when accessing value of the wrong kind, got %v", textErr)
+	}
+	if terr.Key != "b.c" || terr.Line != 3 || terr.Col != 6 {
+		t.Errorf("mismatching TypeError fields for value of the wrong kind: got %+v", terr)
+	}
+}
+
+func TestEvalTemplateErrors(t *testing.T) {
+	type elem struct {
+		src    string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"a = `${a}`", "reference cycle detected: a -> a for key a at line 1, col 8"},
+		{"a = `${b}`\nb = `x${c.d}`\nc {\n\td = `${a}`\n}", "reference cycle detected: a -> b -> c.d -> a for key a at line 4, col 9"},
+		{"a = `${b.c}`\nb = 1", "cannot resolve b.c as b is not a block for key a at line 1, col 8"},
+		{"a = `${b.c}`\nb {}", "cannot resolve b.c for key a at line 1, col 8"},
+		{"a = `${b}`\nb {}", "cannot interpolate block referenced by b for key a at line 1, col 8"},
+		{"a = `${[1]}`", "cannot interpolate list for key a at line 1, col 8"},
+		{"a {\n\tb = 1\n}\nc = `${b}`", "cannot resolve b for key c at line 4, col 8"},
+		{"y {\n\tz = `${y}`\n}", "reference cycle detected: y.z -> y for key y.z at line 2, col 6"},
+	} {
+		_, err := Eval([]byte(elem.src))
+		if err == nil {
+			t.Errorf("failed to receive expected error when evaluating %q", elem.src)
+			continue
+		}
+		if !strings.Contains(err.Error(), elem.expect) {
+			t.Errorf("mismatching error when evaluating %q: expected %q, got %q", elem.src, elem.expect, err)
+		}
+	}
+	var v struct {
+		Y struct {
+			Z string
+		}
+	}
+	err := Unmarshal([]byte("y {\n\tz = `${y}`\n}"), &v)
+	expect := "reference cycle detected: y.z -> y for key y.z at line 2, col 6"
+	if err == nil || !strings.Contains(err.Error(), expect) {
+		t.Errorf("mismatching error when decoding a template that references its own block: got %v", err)
+	}
+}
+
+func TestEvalTemplates(t *testing.T) {
+	src := "greeting = `${format} was created by ${author.name} in ${author.location}`\n" +
+		"format = \"EON\"\n" +
+		"author {\n" +
+		"\tname = \"tav\"\n" +
+		"\tcity = \"London\"\n" +
+		"\tlocation = `${city}, ${country}`\n" +
+		"\tsigned = `${name} (${format})`\n" +
+		"}\n" +
+		"country = \"GB\"\n" +
+		"host = \"node1.peerbase.net\"\n" +
+		"urls = [`https://${host}:${port}/` `wss://${host}`]\n" +
+		"port = 8080\n" +
+		"escaped = `\\${host} costs \\$5`\n" +
+		"nested = `<${`${host}`}>`\n" +
+		"literal = `${42}-${\"x\"}-${1.5s}`\n"
+	v, err := Eval([]byte(src))
+	if err != nil {
+		t.Fatalf("unexpected error when evaluating templates: %s", err)
+	}
+	type elem struct {
+		path   string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"greeting", "EON was created by tav in London, GB"},
+		{"author.location", "London, GB"},
+		{"author.signed", "tav (EON)"},
+		{"escaped", "${host} costs $5"},
+		{"nested", "<node1.peerbase.net>"},
+		{"literal", "42-x-1.5s"},
+	} {
+		got, err := v.Lookup(elem.path).Text()
+		if err != nil {
+			t.Errorf("unexpected error when accessing %s: %s", elem.path, err)
+			continue
+		}
+		if got != elem.expect {
+			t.Errorf("mismatching value for %s: expected %q, got %q", elem.path, elem.expect, got)
+		}
+	}
+	urls, _ := v.Lookup("urls").List()
+	var got []string
+	for _, url := range urls {
+		s, _ := url.Text()
+		got = append(got, s)
+	}
+	expect := []string{"https://node1.peerbase.net:8080/", "wss://node1.peerbase.net"}
+	if !reflect.DeepEqual(expect, got) {
+		t.Errorf("mismatching values for urls: expected %q, got %q", expect, got)
+	}
+}
@@ -0,0 +1,184 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// field describes a struct field that is mapped to an EON key.
+type field struct {
+	hex       bool
+	index     []int
+	inline    bool
+	multiline bool
+	name      string
+	omitempty bool
+	required  bool
+	tagged    bool
+	typ       reflect.Type
+}
+
+type tagOptions string
+
+func (t tagOptions) has(opt string) bool {
+	s := string(t)
+	for s != "" {
+		var next string
+		if i := strings.IndexByte(s, ','); i >= 0 {
+			s, next = s[:i], s[i+1:]
+		}
+		if s == opt {
+			return true
+		}
+		s = next
+	}
+	return false
+}
+
+// fieldByIndex returns the nested field of rv at the given index. It returns
+// false if the field is behind a nil embedded pointer.
+func fieldByIndex(rv reflect.Value, index []int) (reflect.Value, bool) {
+	for i, idx := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				return reflect.Value{}, false
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(idx)
+	}
+	return rv, true
+}
+
+// fieldByIndexAlloc is like fieldByIndex, but allocates any nil embedded
+// pointers on the way to the field.
+func fieldByIndexAlloc(rv reflect.Value, index []int) reflect.Value {
+	for i, idx := range index {
+		if i > 0 && rv.Kind() == reflect.Ptr {
+			if rv.IsNil() {
+				rv.Set(reflect.New(rv.Type().Elem()))
+			}
+			rv = rv.Elem()
+		}
+		rv = rv.Field(idx)
+	}
+	return rv
+}
+
+func parseTag(tag string) (string, tagOptions) {
+	if i := strings.IndexByte(tag, ','); i >= 0 {
+		return tag[:i], tagOptions(tag[i+1:])
+	}
+	return tag, ""
+}
+
+// structFields returns the fields of the given struct type that are mapped to
+// EON keys, in declaration order. The fields of embedded structs are flattened
+// into the parent using the same rules as encoding/json: a field at a shallower
+// depth hides deeper fields with the same name, and where multiple fields at
+// the same depth share a name, a tagged field is preferred, or otherwise all of
+// them are ignored.
+func structFields(rt reflect.Type) []field {
+	type queued struct {
+		index []int
+		typ   reflect.Type
+	}
+	var (
+		fields  []field
+		next    = []queued{{typ: rt}}
+		seen    = map[string]bool{}
+		visited = map[reflect.Type]bool{}
+	)
+	for len(next) > 0 {
+		current := next
+		next = nil
+		var level []field
+		for _, q := range current {
+			if visited[q.typ] {
+				continue
+			}
+			visited[q.typ] = true
+			n := q.typ.NumField()
+			for i := 0; i < n; i++ {
+				f := q.typ.Field(i)
+				ft := f.Type
+				if f.Anonymous {
+					if ft.Kind() == reflect.Ptr {
+						ft = ft.Elem()
+					}
+					// Skip unexported non-struct types, as well as pointers to
+					// unexported struct types, as they can't be set.
+					if f.PkgPath != "" && (ft.Kind() != reflect.Struct || ft != f.Type) {
+						continue
+					}
+				} else if f.PkgPath != "" {
+					continue
+				}
+				tag := f.Tag.Get("eon")
+				if tag == "-" {
+					continue
+				}
+				name, opts := parseTag(tag)
+				index := make([]int, len(q.index)+1)
+				copy(index, q.index)
+				index[len(q.index)] = i
+				if name == "" && f.Anonymous && ft.Kind() == reflect.Struct {
+					next = append(next, queued{index: index, typ: ft})
+					continue
+				}
+				tagged := name != ""
+				if !tagged {
+					name = string(slugify(f.Name))
+				}
+				level = append(level, field{
+					hex:       opts.has("hex"),
+					index:     index,
+					inline:    opts.has("inline"),
+					multiline: opts.has("multiline"),
+					name:      name,
+					omitempty: opts.has("omitempty"),
+					required:  opts.has("required"),
+					tagged:    tagged,
+					typ:       f.Type,
+				})
+			}
+		}
+		byName := map[string][]field{}
+		for _, f := range level {
+			byName[f.name] = append(byName[f.name], f)
+		}
+		for name, dups := range byName {
+			if seen[name] {
+				continue
+			}
+			seen[name] = true
+			if len(dups) == 1 {
+				fields = append(fields, dups[0])
+				continue
+			}
+			var winner []field
+			for _, f := range dups {
+				if f.tagged {
+					winner = append(winner, f)
+				}
+			}
+			if len(winner) == 1 {
+				fields = append(fields, winner[0])
+			}
+		}
+	}
+	sort.Slice(fields, func(i, j int) bool {
+		a, b := fields[i].index, fields[j].index
+		for k := 0; k < len(a) && k < len(b); k++ {
+			if a[k] != b[k] {
+				return a[k] < b[k]
+			}
+		}
+		return len(a) < len(b)
+	})
+	return fields
+}
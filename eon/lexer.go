@@ -0,0 +1,639 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"peerbase.net/go/lex"
+)
+
+// Token types emitted by the EON lexer.
+const (
+	TokenAssign lex.TokenType = iota + 1
+	TokenBinary
+	TokenByteSize
+	TokenComment
+	TokenDate
+	TokenDot
+	TokenDuration
+	TokenIdent
+	TokenInterpEnd
+	TokenInterpStart
+	TokenLBrace
+	TokenLBracket
+	TokenLParen
+	TokenMultiline
+	TokenNewline
+	TokenNumber
+	TokenRBrace
+	TokenRBracket
+	TokenRParen
+	TokenSeparator
+	TokenString
+	TokenTemplateEnd
+	TokenTemplateStart
+	TokenTemplateText
+	TokenTimestamp
+	TokenVersion
+)
+
+// Error types emitted by the EON lexer.
+const (
+	LexInvalidBinary lex.ErrorType = iota + 1
+	LexInvalidEscape
+	LexInvalidLiteral
+	LexInvalidMultiline
+	LexInvalidUnit
+	LexUnexpectedChar
+	LexUnterminatedString
+	LexUnterminatedTemplate
+)
+
+var literals = []struct {
+	match func(string) (int, bool)
+	typ   lex.TokenType
+}{
+	{matchNumber, TokenNumber},
+	{matchDate, TokenDate},
+	{matchTimestamp, TokenTimestamp},
+	{matchVersion, TokenVersion},
+	{matchDuration, TokenDuration},
+	{matchByteSize, TokenByteSize},
+}
+
+type lexer struct {
+	interps []int
+}
+
+func (l *lexer) lexAny(e *lex.Engine) lex.StateFn {
+	r := e.Peek()
+	switch {
+	case r == lex.EOF:
+		if len(l.interps) > 0 {
+			return e.Errorf(LexUnterminatedTemplate, "unterminated template string")
+		}
+		return nil
+	case r == ' ' || r == '\t' || r == '\r':
+		e.AcceptRun(" \t\r")
+		e.Ignore()
+	case r == '\n':
+		e.Next()
+		e.Emit(TokenNewline)
+	case r == '/' && strings.HasPrefix(e.Input()[e.Pos():], "//"):
+		for r = e.Next(); r != '\n' && r != lex.EOF; r = e.Next() {
+		}
+		e.Backup()
+		e.Emit(TokenComment)
+	case r == '=':
+		e.Next()
+		e.Emit(TokenAssign)
+	case r == ',' || r == ';':
+		e.Next()
+		e.Emit(TokenSeparator)
+	case r == '.':
+		e.Next()
+		e.Emit(TokenDot)
+	case r == '{':
+		e.Next()
+		if n := len(l.interps); n > 0 {
+			l.interps[n-1]++
+		}
+		e.Emit(TokenLBrace)
+	case r == '}':
+		e.Next()
+		if n := len(l.interps); n > 0 {
+			if l.interps[n-1] == 0 {
+				l.interps = l.interps[:n-1]
+				e.Emit(TokenInterpEnd)
+				return l.lexTemplate
+			}
+			l.interps[n-1]--
+		}
+		e.Emit(TokenRBrace)
+	case r == '[':
+		e.Next()
+		e.Emit(TokenLBracket)
+	case r == ']':
+		e.Next()
+		e.Emit(TokenRBracket)
+	case r == '(':
+		e.Next()
+		e.Emit(TokenLParen)
+	case r == ')':
+		e.Next()
+		e.Emit(TokenRParen)
+	case r == '"':
+		if strings.HasPrefix(e.Input()[e.Pos():], `"""`) {
+			return l.lexMultiline
+		}
+		return l.lexString
+	case r == '`':
+		e.Next()
+		e.Emit(TokenTemplateStart)
+		return l.lexTemplate
+	case r == '-' || isDigit(r):
+		return l.lexLiteral
+	case isIdentStart(r):
+		e.AcceptRunFunc(isIdentChar)
+		if e.Peek() == '"' && isBinaryPrefix(e.Pending()) {
+			return l.lexBinary
+		}
+		e.Emit(TokenIdent)
+	default:
+		return e.Errorf(LexUnexpectedChar, "unexpected character %q", r)
+	}
+	return l.lexAny
+}
+
+func (l *lexer) lexBinary(e *lex.Engine) lex.StateFn {
+	valid := isBase64Char
+	if e.Pending() == "hex" {
+		valid = isHexChar
+	}
+	e.Next()
+	for {
+		r := e.Next()
+		switch {
+		case r == '"':
+			e.Emit(TokenBinary)
+			return l.lexAny
+		case r == '\n' || r == lex.EOF:
+			e.Backup()
+			return e.Errorf(LexUnterminatedString, "unterminated binary literal")
+		case !valid(r):
+			e.Backup()
+			return e.Errorf(LexInvalidBinary, "invalid character %q in %s literal", r, e.Pending()[:3])
+		}
+	}
+}
+
+func (l *lexer) lexEscape(e *lex.Engine, extra string) bool {
+	// The backslash has already been consumed.
+	r := e.Next()
+	switch {
+	case r == '"' || r == '\\' || r == '/' || r == 'n' || r == 'r' || r == 't':
+		return true
+	case strings.ContainsRune(extra, r):
+		return true
+	case r == 'x':
+		return l.lexHex(e, 2)
+	case r == 'u':
+		return l.lexHex(e, 4)
+	case r == 'U':
+		return l.lexHex(e, 8)
+	}
+	e.Backup()
+	e.Errorf(LexInvalidEscape, "invalid escape sequence \\%c", r)
+	return false
+}
+
+func (l *lexer) lexHex(e *lex.Engine, size int) bool {
+	var v rune
+	for i := 0; i < size; i++ {
+		r := e.Next()
+		switch {
+		case r >= '0' && r <= '9':
+			v = v<<4 | (r - '0')
+		case r >= 'a' && r <= 'f':
+			v = v<<4 | (r - 'a' + 10)
+		case r >= 'A' && r <= 'F':
+			v = v<<4 | (r - 'A' + 10)
+		default:
+			e.Backup()
+			e.Errorf(LexInvalidEscape, "invalid hex digit %q in escape sequence", r)
+			return false
+		}
+	}
+	if size > 2 && !utf8.ValidRune(v) {
+		e.Errorf(LexInvalidEscape, "invalid unicode code point U+%X in escape sequence", v)
+		return false
+	}
+	return true
+}
+
+func (l *lexer) lexLiteral(e *lex.Engine) lex.StateFn {
+	rest := e.Input()[e.Pos():]
+	end := 1
+	for end < len(rest) {
+		r, size := utf8.DecodeRuneInString(rest[end:])
+		if !isLiteralChar(r) {
+			break
+		}
+		end += size
+	}
+	v := rest[:end]
+	longest := 0
+	for _, lit := range literals {
+		n, ok := lit.match(v)
+		if ok && n == len(v) {
+			for target := e.Pos() + end; e.Pos() < target; {
+				e.Next()
+			}
+			e.Emit(lit.typ)
+			return l.lexAny
+		}
+		if n > longest {
+			longest = n
+		}
+	}
+	// Numbers followed by letters are most likely durations or byte sizes
+	// with a misspelt unit, so point at the unit instead.
+	if i, unit, ok := matchUnknownUnit(v); ok {
+		for target := e.Pos() + i; e.Pos() < target; {
+			e.Next()
+		}
+		return e.Errorf(LexInvalidUnit, "unknown unit %q in literal %q", unit, v)
+	}
+	// Advance to the first character that couldn't be matched by any of the
+	// literal forms, so that the error points at it.
+	target := e.Pos() + longest
+	for e.Pos() < target {
+		e.Next()
+	}
+	if longest == len(v) {
+		return e.Errorf(LexInvalidLiteral, "incomplete literal %q", v)
+	}
+	r, _ := utf8.DecodeRuneInString(v[longest:])
+	return e.Errorf(LexInvalidLiteral, "unexpected character %q in literal %q", r, v)
+}
+
+func (l *lexer) lexMultiline(e *lex.Engine) lex.StateFn {
+	for i := 0; i < 3; i++ {
+		e.Next()
+	}
+	e.Accept("\r")
+	if !e.Accept("\n") {
+		return e.Errorf(LexInvalidMultiline, `multiline string must start with """ followed by a newline`)
+	}
+	for {
+		// The closing delimiter must be the first thing on a line, after any
+		// indentation.
+		e.AcceptRun(" \t")
+		if strings.HasPrefix(e.Input()[e.Pos():], `"""`) {
+			for i := 0; i < 3; i++ {
+				e.Next()
+			}
+			e.Emit(TokenMultiline)
+			return l.lexAny
+		}
+	line:
+		for {
+			switch e.Next() {
+			case '\n':
+				break line
+			case '\\':
+				if !l.lexEscape(e, "") {
+					return nil
+				}
+			case lex.EOF:
+				return e.Errorf(LexUnterminatedString, "unterminated multiline string")
+			}
+		}
+	}
+}
+
+func (l *lexer) lexString(e *lex.Engine) lex.StateFn {
+	e.Next()
+	for {
+		switch e.Next() {
+		case '"':
+			e.Emit(TokenString)
+			return l.lexAny
+		case '\\':
+			if !l.lexEscape(e, "") {
+				return nil
+			}
+		case '\n', lex.EOF:
+			e.Backup()
+			return e.Errorf(LexUnterminatedString, "unterminated string literal")
+		}
+	}
+}
+
+func (l *lexer) lexTemplate(e *lex.Engine) lex.StateFn {
+	for {
+		if strings.HasPrefix(e.Input()[e.Pos():], "${") {
+			if len(e.Pending()) > 0 {
+				e.Emit(TokenTemplateText)
+			}
+			e.Next()
+			e.Next()
+			e.Emit(TokenInterpStart)
+			l.interps = append(l.interps, 0)
+			return l.lexAny
+		}
+		switch e.Next() {
+		case '`':
+			e.Backup()
+			if len(e.Pending()) > 0 {
+				e.Emit(TokenTemplateText)
+			}
+			e.Next()
+			e.Emit(TokenTemplateEnd)
+			return l.lexAny
+		case '\\':
+			if !l.lexEscape(e, "`$") {
+				return nil
+			}
+		case lex.EOF:
+			return e.Errorf(LexUnterminatedTemplate, "unterminated template string")
+		}
+	}
+}
+
+// Lex returns a lexing Engine that tokenizes the given EON source. Tokens have
+// one of the Token* types defined by this package, and errors have one of the
+// Lex* error types.
+func Lex(src string) *lex.Engine {
+	l := &lexer{}
+	return lex.New(src, l.lexAny)
+}
+
+func isBase64Char(r rune) bool {
+	return (r >= 'A' && r <= 'Z') || (r >= 'a' && r <= 'z') || isDigit(r) || r == '+' || r == '/' || r == '='
+}
+
+// isBinaryPrefix returns whether the given identifier introduces a binary
+// literal when immediately followed by a string, e.g. b64"AQID" or hex"010203".
+func isBinaryPrefix(s string) bool {
+	return s == "b64" || s == "hex"
+}
+
+func isDigit(r rune) bool {
+	return r >= '0' && r <= '9'
+}
+
+func isHexChar(r rune) bool {
+	return isDigit(r) || (r >= 'a' && r <= 'f') || (r >= 'A' && r <= 'F')
+}
+
+func isIdentChar(r rune) bool {
+	return isIdentStart(r) || isDigit(r) || r == '-'
+}
+
+func isIdentStart(r rune) bool {
+	return r == '_' || unicode.IsLetter(r)
+}
+
+func isLiteralChar(r rune) bool {
+	switch r {
+	case '.', '-', '+', ':', '_':
+		return true
+	}
+	return isDigit(r) || unicode.IsLetter(r)
+}
+
+func isVersionChar(c byte) bool {
+	return isDigit(rune(c)) || (c >= 'a' && c <= 'z') || (c >= 'A' && c <= 'Z') || c == '-'
+}
+
+func matchByteSize(s string) (int, bool) {
+	i := matchDigits(s, 0)
+	if i == 0 {
+		return 0, false
+	}
+	switch strings.ToUpper(s[i:]) {
+	case "B", "KB", "MB", "GB", "TB", "PB":
+		return len(s), true
+	}
+	return i, false
+}
+
+func matchDate(s string) (int, bool) {
+	i := 0
+	for n, width := range []int{4, 2, 2} {
+		if n > 0 {
+			if i == len(s) || s[i] != '-' {
+				return i, false
+			}
+			i++
+		}
+		for j := 0; j < width; j++ {
+			if i == len(s) || !isDigit(rune(s[i])) {
+				return i, false
+			}
+			i++
+		}
+	}
+	return i, true
+}
+
+func matchDigits(s string, i int) int {
+	for i < len(s) && isDigit(rune(s[i])) {
+		i++
+	}
+	return i
+}
+
+func matchDuration(s string) (int, bool) {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	ok := false
+	for i < len(s) {
+		j := matchDigits(s, i)
+		if j == i {
+			return i, false
+		}
+		if j < len(s) && s[j] == '.' {
+			k := matchDigits(s, j+1)
+			if k == j+1 {
+				return j + 1, false
+			}
+			j = k
+		}
+		k := j
+		for k < len(s) {
+			r, size := utf8.DecodeRuneInString(s[k:])
+			if !unicode.IsLetter(r) {
+				break
+			}
+			k += size
+		}
+		switch s[j:k] {
+		case "ns", "us", "µs", "μs", "ms", "s", "m", "h":
+		default:
+			return j, false
+		}
+		i = k
+		ok = true
+	}
+	return i, ok
+}
+
+func matchNumber(s string) (int, bool) {
+	i := 0
+	if s[0] == '-' {
+		i++
+	}
+	j := matchDigits(s, i)
+	if j == i {
+		return i, false
+	}
+	i = j
+	if i < len(s) && s[i] == '.' {
+		j = matchDigits(s, i+1)
+		if j == i+1 {
+			return i, false
+		}
+		i = j
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		j = i + 1
+		if j < len(s) && (s[j] == '+' || s[j] == '-') {
+			j++
+		}
+		k := matchDigits(s, j)
+		if k == j {
+			return i, false
+		}
+		i = k
+	}
+	return i, true
+}
+
+// matchTimestamp matches an RFC 3339 timestamp, e.g. 2018-09-01T12:30:00Z or
+// 2018-09-01T12:30:00.5+01:00.
+func matchTimestamp(s string) (int, bool) {
+	i, ok := matchDate(s)
+	if !ok {
+		return i, false
+	}
+	if i == len(s) || s[i] != 'T' {
+		return i, false
+	}
+	i++
+	for n := 0; n < 3; n++ {
+		if n > 0 {
+			if i == len(s) || s[i] != ':' {
+				return i, false
+			}
+			i++
+		}
+		if j := matchDigits(s, i); j != i+2 {
+			return i, false
+		}
+		i += 2
+	}
+	if i < len(s) && s[i] == '.' {
+		j := matchDigits(s, i+1)
+		if j == i+1 {
+			return i + 1, false
+		}
+		i = j
+	}
+	if i == len(s) {
+		return i, false
+	}
+	switch s[i] {
+	case 'Z':
+		return i + 1, true
+	case '+', '-':
+		i++
+		if j := matchDigits(s, i); j != i+2 {
+			return i, false
+		}
+		i += 2
+		if i == len(s) || s[i] != ':' {
+			return i, false
+		}
+		i++
+		if j := matchDigits(s, i); j != i+2 {
+			return i, false
+		}
+		return i + 2, true
+	}
+	return i, false
+}
+
+// matchUnknownUnit returns the offset and value of the first unit that isn't
+// a valid duration or byte size unit, within a literal that's made up of
+// numbers followed by units, e.g. 20XB or 5h30min.
+func matchUnknownUnit(s string) (int, string, bool) {
+	i := 0
+	if s[0] == '-' {
+		i++
+	}
+	for i < len(s) {
+		j := matchDigits(s, i)
+		if j == i {
+			return 0, "", false
+		}
+		if j < len(s) && s[j] == '.' {
+			k := matchDigits(s, j+1)
+			if k == j+1 {
+				return 0, "", false
+			}
+			j = k
+		}
+		k := j
+		for k < len(s) {
+			r, size := utf8.DecodeRuneInString(s[k:])
+			if !unicode.IsLetter(r) {
+				break
+			}
+			k += size
+		}
+		if k == j {
+			return 0, "", false
+		}
+		unit := s[j:k]
+		switch unit {
+		case "ns", "us", "µs", "μs", "ms", "s", "m", "h":
+		default:
+			switch strings.ToUpper(unit) {
+			case "B", "KB", "MB", "GB", "TB", "PB":
+			default:
+				return j, unit, true
+			}
+		}
+		i = k
+	}
+	return 0, "", false
+}
+
+// matchVersion matches a semantic version, e.g. 1.4.2, including any
+// pre-release and build metadata, e.g. 1.4.2-beta.1+build.7. The identifiers
+// are validated further by the parser.
+func matchVersion(s string) (int, bool) {
+	i := 0
+	for n := 0; n < 3; n++ {
+		if n > 0 {
+			if i == len(s) || s[i] != '.' {
+				return i, false
+			}
+			i++
+		}
+		j := matchDigits(s, i)
+		if j == i {
+			return i, false
+		}
+		i = j
+	}
+	for _, sep := range []byte{'-', '+'} {
+		if i == len(s) || s[i] != sep {
+			continue
+		}
+		i++
+		for {
+			j := i
+			for j < len(s) && isVersionChar(s[j]) {
+				j++
+			}
+			if j == i {
+				return i, false
+			}
+			i = j
+			if i == len(s) || s[i] != '.' {
+				break
+			}
+			i++
+		}
+	}
+	return i, true
+}
@@ -0,0 +1,143 @@
+package eon
+
+import (
+	"io/ioutil"
+	"reflect"
+	"testing"
+
+	"peerbase.net/go/lex"
+)
+
+func TestLex(t *testing.T) {
+	src := "format = \"EON\" // comment\ncreated = 2018-09-01\nversion = 0.0.1\n" +
+		"author {\n\taddictions = [\"Gauloises\", \"Nutella\"]\n}\n" +
+		"print `${format} by ${author.name}, \\${x} {y}` (str.upper x)"
+	tokens, err := Lex(src).Run()
+	if err != nil {
+		t.Fatalf("unexpected error when lexing: %s", err)
+	}
+	type tok struct {
+		typ lex.TokenType
+		val string
+	}
+	expect := []tok{
+		{TokenIdent, "format"}, {TokenAssign, "="}, {TokenString, `"EON"`},
+		{TokenComment, "// comment"}, {TokenNewline, "\n"},
+		{TokenIdent, "created"}, {TokenAssign, "="}, {TokenDate, "2018-09-01"}, {TokenNewline, "\n"},
+		{TokenIdent, "version"}, {TokenAssign, "="}, {TokenVersion, "0.0.1"}, {TokenNewline, "\n"},
+		{TokenIdent, "author"}, {TokenLBrace, "{"}, {TokenNewline, "\n"},
+		{TokenIdent, "addictions"}, {TokenAssign, "="}, {TokenLBracket, "["},
+		{TokenString, `"Gauloises"`}, {TokenSeparator, ","}, {TokenString, `"Nutella"`},
+		{TokenRBracket, "]"}, {TokenNewline, "\n"}, {TokenRBrace, "}"}, {TokenNewline, "\n"},
+		{TokenIdent, "print"}, {TokenTemplateStart, "`"},
+		{TokenInterpStart, "${"}, {TokenIdent, "format"}, {TokenInterpEnd, "}"},
+		{TokenTemplateText, " by "},
+		{TokenInterpStart, "${"}, {TokenIdent, "author"}, {TokenDot, "."}, {TokenIdent, "name"}, {TokenInterpEnd, "}"},
+		{TokenTemplateText, ", \\${x} {y}"}, {TokenTemplateEnd, "`"},
+		{TokenLParen, "("}, {TokenIdent, "str"}, {TokenDot, "."}, {TokenIdent, "upper"},
+		{TokenIdent, "x"}, {TokenRParen, ")"},
+	}
+	var got []tok
+	for _, t := range tokens {
+		got = append(got, tok{t.Type, t.Value})
+	}
+	if !reflect.DeepEqual(expect, got) {
+		t.Errorf("mismatching tokens:\nexpected %v\ngot      %v", expect, got)
+	}
+	last := tokens[len(tokens)-1]
+	if last.Line != 7 || last.Col != 60 {
+		t.Errorf("unexpected position for last token: line %d, col %d", last.Line, last.Col)
+	}
+}
+
+func TestLexAuthors(t *testing.T) {
+	src, err := ioutil.ReadFile("../AUTHORS.eon")
+	if err != nil {
+		t.Fatalf("unable to read AUTHORS.eon: %s", err)
+	}
+	if _, err := Lex(string(src)).Run(); err != nil {
+		t.Fatalf("unexpected error when lexing AUTHORS.eon: %s", err)
+	}
+}
+
+func TestLexErrors(t *testing.T) {
+	type elem struct {
+		src  string
+		typ  lex.ErrorType
+		line int
+		col  int
+	}
+	for _, elem := range []elem{
+		{"a = \"hello", LexUnterminatedString, 1, 11},
+		{"a = 1\nb = \"x\\qy\"", LexInvalidEscape, 2, 8},
+		{"a = \"\\x4g\"", LexInvalidEscape, 1, 9},
+		{"a = 1.2.3.4", LexInvalidLiteral, 1, 10},
+		{"a = 12x", LexInvalidUnit, 1, 7},
+		{"a = 5h2", LexInvalidLiteral, 1, 8},
+		{"a = 20XB", LexInvalidUnit, 1, 7},
+		{"a = 1h30min", LexInvalidUnit, 1, 9},
+		{"a = 1.", LexInvalidLiteral, 1, 7},
+		{"a = 2018-09", LexInvalidLiteral, 1, 12},
+		{"\n  a = @", LexUnexpectedChar, 2, 7},
+		{"a = `${x", LexUnterminatedTemplate, 1, 9},
+		{"a = `héllo", LexUnterminatedTemplate, 1, 11},
+		{"a = b64\"AQ-D\"", LexInvalidBinary, 1, 11},
+		{"a = hex\"0g\"", LexInvalidBinary, 1, 10},
+		{"a = hex\"00\nb = 1", LexUnterminatedString, 1, 11},
+		{"a = \"\"\"x\n\"\"\"", LexInvalidMultiline, 1, 8},
+		{"a = \"\"\"\n\tx\n", LexUnterminatedString, 3, 1},
+		{"a = \"\"\"\n\t\\q\n\t\"\"\"", LexInvalidEscape, 2, 3},
+	} {
+		_, err := Lex(elem.src).Run()
+		lerr, ok := err.(*lex.Error)
+		if !ok {
+			t.Errorf("expected *lex.Error when lexing %q, got %v", elem.src, err)
+			continue
+		}
+		if lerr.Type != elem.typ || lerr.Line != elem.line || lerr.Col != elem.col {
+			t.Errorf(
+				"mismatching error when lexing %q: expected type %d at line %d, col %d, got %+v",
+				elem.src, elem.typ, elem.line, elem.col, lerr)
+		}
+	}
+}
+
+func TestLexLiterals(t *testing.T) {
+	type elem struct {
+		src string
+		typ lex.TokenType
+	}
+	for _, elem := range []elem{
+		{"0", TokenNumber},
+		{"-128", TokenNumber},
+		{"1.024", TokenNumber},
+		{"1e-7", TokenNumber},
+		{"1.5E+10", TokenNumber},
+		{"2018-09-01", TokenDate},
+		{"2018-09-01T12:30:00Z", TokenTimestamp},
+		{"2018-09-01T12:30:00.123+05:30", TokenTimestamp},
+		{"2018-09-01T12:30:00-08:00", TokenTimestamp},
+		{"0.0.1", TokenVersion},
+		{"10.20.300", TokenVersion},
+		{"1.4.2-beta.1+build.7", TokenVersion},
+		{"0.0.1+20180901", TokenVersion},
+		{"5h27m0s", TokenDuration},
+		{"1.024s", TokenDuration},
+		{"100ns", TokenDuration},
+		{"-3µs", TokenDuration},
+		{"327GB", TokenByteSize},
+		{"327029B", TokenByteSize},
+		{"20kb", TokenByteSize},
+		{`b64"AQID"`, TokenBinary},
+		{`hex"0a0B"`, TokenBinary},
+	} {
+		tokens, err := Lex(elem.src).Run()
+		if err != nil {
+			t.Errorf("unexpected error when lexing %q: %s", elem.src, err)
+			continue
+		}
+		if len(tokens) != 1 || tokens[0].Type != elem.typ || tokens[0].Value != elem.src {
+			t.Errorf("mismatching tokens for %q: expected a single token of type %d, got %+v", elem.src, elem.typ, tokens)
+		}
+	}
+}
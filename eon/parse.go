@@ -0,0 +1,721 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"peerbase.net/go/lex"
+	"peerbase.net/go/semver"
+)
+
+// Node kinds.
+const (
+	nodeBinary nodeKind = iota + 1
+	nodeBlock
+	nodeBool
+	nodeByteSize
+	nodeCall
+	nodeDate
+	nodeDuration
+	nodeList
+	nodeNull
+	nodeNumber
+	nodeRef
+	nodeString
+	nodeTemplate
+	nodeTimestamp
+	nodeVersion
+)
+
+var literalKinds = map[lex.TokenType]nodeKind{
+	TokenByteSize:  nodeByteSize,
+	TokenDuration:  nodeDuration,
+	TokenNumber:    nodeNumber,
+	TokenTimestamp: nodeTimestamp,
+}
+
+// entry represents a key within a block. The start and keyEnd fields hold the
+// byte offsets of the key within the source.
+type entry struct {
+	col    int
+	key    string
+	keyEnd int
+	line   int
+	start  int
+	value  *node
+}
+
+// node represents a parsed EON value. For literals, text holds the source text,
+// except for strings where it holds the unescaped value, and binary literals
+// where it holds the decoded bytes. The parts of a template are held in elems.
+type node struct {
+	calls   []*node
+	col     int
+	elems   []*node
+	end     int
+	entries []*entry
+	kind    nodeKind
+	line    int
+	start   int
+	text    string
+}
+
+func (n *node) describe() string {
+	switch n.kind {
+	case nodeBinary:
+		return "binary"
+	case nodeBlock:
+		return "block"
+	case nodeBool:
+		return "bool"
+	case nodeByteSize:
+		return "byte size " + n.text
+	case nodeCall:
+		return "call to " + n.text
+	case nodeDate:
+		return "date " + n.text
+	case nodeDuration:
+		return "duration " + n.text
+	case nodeList:
+		return "list"
+	case nodeNull:
+		return "null"
+	case nodeNumber:
+		return "number " + n.text
+	case nodeRef:
+		return "reference " + n.text
+	case nodeString:
+		return "string"
+	case nodeTemplate:
+		return "template string"
+	case nodeTimestamp:
+		return "timestamp " + n.text
+	case nodeVersion:
+		return "version " + n.text
+	}
+	return "unknown node"
+}
+
+type nodeKind int
+
+type parser struct {
+	idx  int
+	line int
+	src  string
+	toks []lex.Token
+}
+
+func (p *parser) eof() lex.Token {
+	line := p.line + 1 + strings.Count(p.src, "\n")
+	last := p.src[strings.LastIndexByte(p.src, '\n')+1:]
+	return lex.Token{
+		Col:  1 + utf8.RuneCountInString(last),
+		Line: line,
+		Pos:  len(p.src),
+	}
+}
+
+func (p *parser) errorf(tok lex.Token, format string, args ...interface{}) error {
+	return &SyntaxError{
+		Col:  tok.Col,
+		Line: tok.Line,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (p *parser) isBody() bool {
+	i := p.idx
+	for i < len(p.toks) && p.toks[i].Type == TokenNewline {
+		i++
+	}
+	if i == len(p.toks) {
+		return true
+	}
+	switch tok := p.toks[i]; {
+	case tok.Type == TokenIdent && !isKeyword(tok.Value):
+		// Non-keyword identifiers start either an entry or a call statement.
+		return true
+	case tok.Type != TokenIdent && tok.Type != TokenString:
+		return false
+	}
+	// Strings and keywords only start an entry when used as its key.
+	if i+1 == len(p.toks) {
+		return false
+	}
+	typ := p.toks[i+1].Type
+	return typ == TokenAssign || typ == TokenLBrace
+}
+
+// isCall returns whether the key that has just been consumed is the start of a
+// function call statement rather than an entry, i.e. if it's followed by a
+// dotted path or an argument.
+func (p *parser) isCall() bool {
+	if p.idx == len(p.toks) {
+		return false
+	}
+	switch p.toks[p.idx].Type {
+	case TokenAssign, TokenLBrace, TokenNewline, TokenRBrace, TokenSeparator:
+		return false
+	}
+	return true
+}
+
+func (p *parser) next() (lex.Token, bool) {
+	if p.idx == len(p.toks) {
+		return p.eof(), false
+	}
+	tok := p.toks[p.idx]
+	p.idx++
+	return tok, true
+}
+
+// parseArg parses an argument to a function call. Bare identifiers are parsed
+// as references, and parentheses can be used to pass the result of a nested
+// call as an argument.
+func (p *parser) parseArg() (*node, error) {
+	if p.idx == len(p.toks) {
+		return p.parseValue()
+	}
+	switch tok := p.toks[p.idx]; {
+	case tok.Type == TokenLParen:
+		p.idx++
+		p.skipNewlines()
+		var (
+			n   *node
+			err error
+		)
+		if p.idx < len(p.toks) && p.toks[p.idx].Type == TokenIdent && !isKeyword(p.toks[p.idx].Value) {
+			n, err = p.parseCall(TokenRParen)
+		} else {
+			n, err = p.parseArg()
+		}
+		if err != nil {
+			return nil, err
+		}
+		p.skipNewlines()
+		tok, _ = p.next()
+		if tok.Type != TokenRParen {
+			return nil, p.errorf(tok, "unexpected %s, expected ')'", describeToken(tok))
+		}
+		return n, nil
+	case tok.Type == TokenIdent && !isKeyword(tok.Value):
+		return p.parseRef()
+	}
+	return p.parseValue()
+}
+
+func (p *parser) parseBody(n *node, closing lex.TokenType) error {
+	for {
+		tok, ok := p.next()
+		if !ok {
+			if closing == 0 {
+				n.end = len(p.src)
+				return nil
+			}
+			return p.errorf(tok, "unexpected end of input, expected '}'")
+		}
+		switch tok.Type {
+		case TokenNewline, TokenSeparator:
+			continue
+		case closing:
+			n.end = tok.Pos + 1
+			return nil
+		case TokenIdent, TokenString:
+		default:
+			return p.errorf(tok, "unexpected %s, expected key", describeToken(tok))
+		}
+		if tok.Type == TokenIdent && p.isCall() {
+			p.idx--
+			call, err := p.parseCall(TokenNewline)
+			if err != nil {
+				return err
+			}
+			n.calls = append(n.calls, call)
+			continue
+		}
+		key := tok.Value
+		if tok.Type == TokenString {
+			key = unescape(key[1 : len(key)-1])
+		}
+		e := &entry{
+			col:    tok.Col,
+			key:    key,
+			keyEnd: tok.Pos + len(tok.Value),
+			line:   tok.Line,
+			start:  tok.Pos,
+		}
+		tok, _ = p.next()
+		switch tok.Type {
+		case TokenAssign:
+			p.skipNewlines()
+			v, err := p.parseValue()
+			if err != nil {
+				return err
+			}
+			e.value = v
+		case TokenLBrace:
+			v, err := p.parseBlock(tok)
+			if err != nil {
+				return err
+			}
+			e.value = v
+		default:
+			return p.errorf(tok, "unexpected %s after key %q, expected '=' or '{'", describeToken(tok), key)
+		}
+		n.entries = append(n.entries, e)
+	}
+}
+
+func (p *parser) parseBlock(open lex.Token) (*node, error) {
+	n := &node{
+		col:   open.Col,
+		kind:  nodeBlock,
+		line:  open.Line,
+		start: open.Pos,
+	}
+	if err := p.parseBody(n, TokenRBrace); err != nil {
+		return nil, err
+	}
+	return n, nil
+}
+
+// parseCall parses a call to the function named by the reference at the
+// current position. The arguments run up to the given closing token, which is
+// left unconsumed. Call statements within a block, which are closed by a
+// newline, also end at a separator or the end of the block. If there are no
+// arguments, a plain reference is returned instead.
+func (p *parser) parseCall(closing lex.TokenType) (*node, error) {
+	ref, err := p.parseRef()
+	if err != nil {
+		return nil, err
+	}
+	n := &node{
+		col:   ref.col,
+		end:   ref.end,
+		kind:  nodeCall,
+		line:  ref.line,
+		start: ref.start,
+		text:  ref.text,
+	}
+	for p.idx < len(p.toks) {
+		typ := p.toks[p.idx].Type
+		if typ == closing {
+			break
+		}
+		if closing == TokenNewline {
+			if typ == TokenSeparator || typ == TokenRBrace {
+				break
+			}
+		} else if typ == TokenNewline {
+			p.idx++
+			continue
+		}
+		arg, err := p.parseArg()
+		if err != nil {
+			return nil, err
+		}
+		n.elems = append(n.elems, arg)
+		n.end = arg.end
+	}
+	if len(n.elems) == 0 {
+		return ref, nil
+	}
+	return n, nil
+}
+
+func (p *parser) parseInterp() (*node, error) {
+	p.skipNewlines()
+	var (
+		n   *node
+		err error
+	)
+	if p.idx < len(p.toks) && p.toks[p.idx].Type == TokenIdent && !isKeyword(p.toks[p.idx].Value) {
+		n, err = p.parseCall(TokenInterpEnd)
+	} else {
+		n, err = p.parseArg()
+	}
+	if err != nil {
+		return nil, err
+	}
+	p.skipNewlines()
+	tok, _ := p.next()
+	if tok.Type != TokenInterpEnd {
+		return nil, p.errorf(tok, "unexpected %s in interpolation, expected '}'", describeToken(tok))
+	}
+	return n, nil
+}
+
+func (p *parser) parseList(open lex.Token) (*node, error) {
+	n := &node{
+		col:   open.Col,
+		kind:  nodeList,
+		line:  open.Line,
+		start: open.Pos,
+	}
+	for {
+		if p.idx == len(p.toks) {
+			return nil, p.errorf(p.eof(), "unexpected end of input, expected ']'")
+		}
+		switch p.toks[p.idx].Type {
+		case TokenNewline, TokenSeparator:
+			p.idx++
+			continue
+		case TokenRBracket:
+			n.end = p.toks[p.idx].Pos + 1
+			p.idx++
+			return n, nil
+		}
+		elem, err := p.parseValue()
+		if err != nil {
+			return nil, err
+		}
+		n.elems = append(n.elems, elem)
+	}
+}
+
+// parseMultiline returns the value of a multiline string. The indentation of
+// the closing delimiter is stripped from every line, and lines consisting only
+// of whitespace are treated as empty.
+func (p *parser) parseMultiline(tok lex.Token) (string, error) {
+	raw := tok.Value[3 : len(tok.Value)-3]
+	raw = strings.TrimPrefix(strings.TrimPrefix(raw, "\r"), "\n")
+	i := strings.LastIndexByte(raw, '\n')
+	if i == -1 {
+		return "", nil
+	}
+	indent := raw[i+1:]
+	body := raw[:i]
+	lines := strings.Split(body, "\n")
+	for idx, line := range lines {
+		line = strings.TrimSuffix(line, "\r")
+		switch {
+		case strings.HasPrefix(line, indent):
+			lines[idx] = unescape(line[len(indent):])
+		case strings.TrimLeft(line, " \t") == "":
+			lines[idx] = ""
+		default:
+			return "", p.errorf(lex.Token{Col: 1, Line: tok.Line + idx + 1}, "line in multiline string is not indented to match the closing delimiter")
+		}
+	}
+	return strings.Join(lines, "\n"), nil
+}
+
+func (p *parser) parseRef() (*node, error) {
+	tok, _ := p.next()
+	n := &node{
+		col:   tok.Col,
+		kind:  nodeRef,
+		line:  tok.Line,
+		start: tok.Pos,
+	}
+	keys := []string{tok.Value}
+	for p.idx < len(p.toks) && p.toks[p.idx].Type == TokenDot {
+		p.idx++
+		tok, _ = p.next()
+		if tok.Type != TokenIdent {
+			return nil, p.errorf(tok, "unexpected %s in reference, expected identifier", describeToken(tok))
+		}
+		keys = append(keys, tok.Value)
+	}
+	n.end = tok.Pos + len(tok.Value)
+	n.text = strings.Join(keys, ".")
+	return n, nil
+}
+
+func (p *parser) parseTemplate(open lex.Token) (*node, error) {
+	n := &node{
+		col:   open.Col,
+		kind:  nodeTemplate,
+		line:  open.Line,
+		start: open.Pos,
+	}
+	for {
+		tok, ok := p.next()
+		if !ok {
+			return nil, p.errorf(tok, "unexpected end of input in template string")
+		}
+		switch tok.Type {
+		case TokenTemplateEnd:
+			n.end = tok.Pos + 1
+			return n, nil
+		case TokenTemplateText:
+			n.elems = append(n.elems, &node{
+				col:   tok.Col,
+				end:   tok.Pos + len(tok.Value),
+				kind:  nodeString,
+				line:  tok.Line,
+				start: tok.Pos,
+				text:  unescape(tok.Value),
+			})
+		case TokenInterpStart:
+			elem, err := p.parseInterp()
+			if err != nil {
+				return nil, err
+			}
+			n.elems = append(n.elems, elem)
+		default:
+			return nil, p.errorf(tok, "unexpected %s in template string", describeToken(tok))
+		}
+	}
+}
+
+func (p *parser) parseValue() (*node, error) {
+	tok, ok := p.next()
+	if !ok {
+		return nil, p.errorf(tok, "unexpected end of input, expected value")
+	}
+	n := &node{
+		col:   tok.Col,
+		end:   tok.Pos + len(tok.Value),
+		line:  tok.Line,
+		start: tok.Pos,
+		text:  tok.Value,
+	}
+	switch tok.Type {
+	case TokenBinary:
+		v, err := decodeBinary(tok.Value)
+		if err != nil {
+			return nil, p.errorf(tok, "invalid %s literal: %s", tok.Value[:3], err)
+		}
+		n.kind = nodeBinary
+		n.text = string(v)
+	case TokenDate:
+		if _, err := time.Parse(dateLayout, tok.Value); err != nil {
+			return nil, p.errorf(tok, "invalid date %s: %s", tok.Value, describeTimeError(err))
+		}
+		n.kind = nodeDate
+	case TokenIdent:
+		switch tok.Value {
+		case "true", "false":
+			n.kind = nodeBool
+		case "null":
+			n.kind = nodeNull
+		default:
+			return nil, p.errorf(tok, "unexpected identifier %q, expected value", tok.Value)
+		}
+	case TokenLBrace:
+		return p.parseBlock(tok)
+	case TokenLBracket:
+		return p.parseList(tok)
+	case TokenString:
+		n.kind = nodeString
+		n.text = unescape(tok.Value[1 : len(tok.Value)-1])
+	case TokenMultiline:
+		s, err := p.parseMultiline(tok)
+		if err != nil {
+			return nil, err
+		}
+		n.kind = nodeString
+		n.text = s
+	case TokenTemplateStart:
+		return p.parseTemplate(tok)
+	case TokenTimestamp:
+		if _, err := time.Parse(time.RFC3339Nano, tok.Value); err != nil {
+			return nil, p.errorf(tok, "invalid timestamp %s: %s", tok.Value, describeTimeError(err))
+		}
+		n.kind = nodeTimestamp
+	case TokenVersion:
+		if _, err := semver.Parse(tok.Value); err != nil {
+			return nil, p.errorf(tok, "%s", strings.TrimPrefix(err.Error(), "semver: "))
+		}
+		n.kind = nodeVersion
+	default:
+		kind, ok := literalKinds[tok.Type]
+		if !ok {
+			return nil, p.errorf(tok, "unexpected %s, expected value", describeToken(tok))
+		}
+		n.kind = kind
+	}
+	return n, nil
+}
+
+func (p *parser) skipNewlines() {
+	for p.idx < len(p.toks) && p.toks[p.idx].Type == TokenNewline {
+		p.idx++
+	}
+}
+
+// decodeBinary decodes the content of a b64"..." or hex"..." literal. The
+// lexer has already checked that it only contains valid characters.
+func decodeBinary(lit string) ([]byte, error) {
+	v := lit[4 : len(lit)-1]
+	if lit[:3] == "b64" {
+		return base64.StdEncoding.DecodeString(v)
+	}
+	if len(v)%2 != 0 {
+		return nil, errors.New("odd number of hex digits")
+	}
+	buf := make([]byte, len(v)/2)
+	for i := range buf {
+		b, _ := strconv.ParseUint(v[2*i:2*i+2], 16, 8)
+		buf[i] = byte(b)
+	}
+	return buf, nil
+}
+
+// describeTimeError returns the reason that a date or timestamp failed to
+// parse, without the quoted input that's included by the time package.
+func describeTimeError(err error) string {
+	if err, ok := err.(*time.ParseError); ok && err.Message != "" {
+		return strings.TrimPrefix(err.Message, ": ")
+	}
+	return "out of range"
+}
+
+func describeToken(tok lex.Token) string {
+	switch tok.Type {
+	case TokenAssign:
+		return "'='"
+	case TokenBinary:
+		return tok.Value[:3] + " literal"
+	case TokenByteSize:
+		return "byte size " + tok.Value
+	case TokenDate:
+		return "date " + tok.Value
+	case TokenDot:
+		return "'.'"
+	case TokenDuration:
+		return "duration " + tok.Value
+	case TokenIdent:
+		return "identifier " + strconv.Quote(tok.Value)
+	case TokenInterpEnd, TokenRBrace:
+		return "'}'"
+	case TokenInterpStart:
+		return "'${'"
+	case TokenLBrace:
+		return "'{'"
+	case TokenLBracket:
+		return "'['"
+	case TokenLParen:
+		return "'('"
+	case TokenMultiline:
+		return "multiline string"
+	case TokenNewline:
+		return "newline"
+	case TokenNumber:
+		return "number " + tok.Value
+	case TokenRBracket:
+		return "']'"
+	case TokenRParen:
+		return "')'"
+	case TokenSeparator:
+		return "separator"
+	case TokenString:
+		return "string"
+	case TokenTemplateEnd, TokenTemplateStart:
+		return "'`'"
+	case TokenTemplateText:
+		return "template text"
+	case TokenTimestamp:
+		return "timestamp " + tok.Value
+	case TokenVersion:
+		return "version " + tok.Value
+	}
+	return "end of input"
+}
+
+func isKeyword(s string) bool {
+	return s == "true" || s == "false" || s == "null"
+}
+
+func parse(data []byte) (*node, error) {
+	return parseAt(data, 0)
+}
+
+// parseAt parses data that follows the given number of lines within a larger
+// input, so that positions are reported relative to the whole input.
+func parseAt(data []byte, line int) (*node, error) {
+	src := string(data)
+	toks, err := Lex(src).Run()
+	if err != nil {
+		if lerr, ok := err.(*lex.Error); ok {
+			return nil, &SyntaxError{
+				Col:  lerr.Col,
+				Line: lerr.Line + line,
+				Msg:  lerr.Value,
+			}
+		}
+		return nil, err
+	}
+	p := &parser{
+		line: line,
+		src:  src,
+		toks: toks[:0],
+	}
+	for _, tok := range toks {
+		if tok.Type != TokenComment {
+			tok.Line += line
+			p.toks = append(p.toks, tok)
+		}
+	}
+	if p.isBody() {
+		n := &node{
+			col:  1,
+			kind: nodeBlock,
+			line: line + 1,
+		}
+		if err := p.parseBody(n, 0); err != nil {
+			return nil, err
+		}
+		return n, nil
+	}
+	p.skipNewlines()
+	n, err := p.parseValue()
+	if err != nil {
+		return nil, err
+	}
+	for tok, ok := p.next(); ok; tok, ok = p.next() {
+		if tok.Type != TokenNewline {
+			return nil, p.errorf(tok, "unexpected %s after top-level value", describeToken(tok))
+		}
+	}
+	return n, nil
+}
+
+// unescape resolves the escape sequences within the given string or template
+// text. The escape sequences are assumed to have been validated by the lexer.
+func unescape(v string) string {
+	if strings.IndexByte(v, '\\') == -1 {
+		return v
+	}
+	buf := make([]byte, 0, len(v))
+	for i := 0; i < len(v); i++ {
+		c := v[i]
+		if c != '\\' {
+			buf = append(buf, c)
+			continue
+		}
+		i++
+		switch c = v[i]; c {
+		case 'n':
+			buf = append(buf, '\n')
+		case 'r':
+			buf = append(buf, '\r')
+		case 't':
+			buf = append(buf, '\t')
+		case 'x':
+			b, _ := strconv.ParseUint(v[i+1:i+3], 16, 8)
+			buf = append(buf, byte(b))
+			i += 2
+		case 'u', 'U':
+			size := 4
+			if c == 'U' {
+				size = 8
+			}
+			r, _ := strconv.ParseUint(v[i+1:i+1+size], 16, 32)
+			buf = append(buf, string(rune(r))...)
+			i += size
+		default:
+			buf = append(buf, c)
+		}
+	}
+	return string(buf)
+}
@@ -0,0 +1,463 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"unicode/utf8"
+
+	"peerbase.net/go/lex"
+)
+
+// Stream states of an Encoder.
+const (
+	streamEmpty = iota
+	streamDocument
+	streamEntry
+)
+
+// Decoder reads and decodes a stream of EON documents, or of top-level
+// entries, from an input stream.
+//
+// Documents within a stream are separated by lines consisting of just ---, as
+// written by an Encoder. Such lines always act as separators, even within
+// multiline strings, and each one ends a document, so that a document with no
+// entries is decoded as an empty block. A separator on the first line of the
+// stream, or one that is directly followed by the end of the stream, doesn't
+// add an extra document. As each document, or entry, is decoded independently
+// of the rest of the stream, template strings can only reference keys within
+// the same document, or entry.
+//
+// By default, a Decoder is as lenient as Unmarshal. The Disallow methods can
+// be used to make it strict, in which case every problem that is found with
+// the keys of a document is reported together as KeyErrors.
+type Decoder struct {
+	entries      []*entry
+	err          error
+	file         string
+	line         int
+	noDuplicates bool
+	noUnknown    bool
+	r            *bufio.Reader
+	root         *node
+	seen         map[string]bool
+	src          string
+}
+
+// Decode reads the next document from the stream and stores it in the value
+// pointed to by v, as per Unmarshal. It returns io.EOF once there are no more
+// documents to read.
+func (d *Decoder) Decode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return fmt.Errorf("eon: Decoder.Decode requires a non-nil pointer, got %v", reflect.TypeOf(v))
+	}
+	if len(d.entries) > 0 {
+		return errors.New("eon: Decoder.Decode called with entries pending from DecodeEntry")
+	}
+	var buf bytes.Buffer
+	start := d.line
+	for {
+		line, err := d.readLine()
+		if err == io.EOF {
+			if buf.Len() == 0 {
+				return io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if isSeparator(line) {
+			if d.line == 1 {
+				start = d.line
+				continue
+			}
+			break
+		}
+		buf.WriteString(line)
+	}
+	n, err := parseAt(buf.Bytes(), start)
+	if err != nil {
+		return withFile(err, d.file)
+	}
+	dec, err := getDecoder(rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	u := &ustate{
+		eval: &estate{
+			builtins: defaultBuiltins,
+			root:     n,
+		},
+		noDuplicates: d.noDuplicates,
+		noUnknown:    d.noUnknown,
+		src:          buf.String(),
+	}
+	if u.noDuplicates {
+		u.checkDuplicates(n)
+	}
+	return withFile(u.finish(u.decode(dec, n, rv.Elem())), d.file)
+}
+
+// DecodeEntry reads the next top-level entry from the stream and stores its
+// value in the value pointed to by v, as per Unmarshal. It returns the key of
+// the entry, or io.EOF once there are no more entries to read. Document
+// separators between entries are skipped.
+//
+// Only as much of the stream is read as is needed to parse the next entry, so
+// that a large sequence of entries can be decoded one at a time.
+func (d *Decoder) DecodeEntry(v interface{}) (string, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Ptr || rv.IsNil() {
+		return "", fmt.Errorf("eon: Decoder.DecodeEntry requires a non-nil pointer, got %v", reflect.TypeOf(v))
+	}
+	for len(d.entries) == 0 {
+		if err := d.readEntries(); err != nil {
+			return "", withFile(err, d.file)
+		}
+	}
+	e := d.entries[0]
+	d.entries = d.entries[1:]
+	dec, err := getDecoder(rv.Type().Elem())
+	if err != nil {
+		return "", err
+	}
+	u := &ustate{
+		eval: &estate{
+			builtins: defaultBuiltins,
+			root:     d.root,
+		},
+		noDuplicates: d.noDuplicates,
+		noUnknown:    d.noUnknown,
+		src:          d.src,
+	}
+	if u.noDuplicates {
+		if d.seen[e.key] {
+			u.keyError(e.line, e.col, e.key, "duplicate key")
+		}
+		if d.seen == nil {
+			d.seen = map[string]bool{}
+		}
+		d.seen[e.key] = true
+		u.path = append(u.path, e.key)
+		u.checkDuplicates(e.value)
+		u.path = u.path[:0]
+	}
+	return e.key, withFile(u.finish(u.decodeEntry(dec, e, rv.Elem())), d.file)
+}
+
+// DisallowDuplicateKeys causes the decoder to return an error when a block
+// contains the same key more than once, instead of using the last value. For
+// DecodeEntry, this also applies to the top-level entries of each document.
+func (d *Decoder) DisallowDuplicateKeys() {
+	d.noDuplicates = true
+}
+
+// DisallowUnknownKeys causes the decoder to return an error when a block is
+// decoded into a struct which has no field for one of its keys, instead of
+// ignoring the key.
+func (d *Decoder) DisallowUnknownKeys() {
+	d.noUnknown = true
+}
+
+// SetFile sets the name of the source being decoded, e.g. the path of a config
+// file, so that it can be included in the errors returned by the decoder.
+func (d *Decoder) SetFile(name string) {
+	d.file = name
+}
+
+// readEntries reads lines from the stream until they form one or more complete
+// entries, and queues them up for DecodeEntry.
+func (d *Decoder) readEntries() error {
+	var (
+		buf  bytes.Buffer
+		scan entryScanner
+	)
+	start := d.line
+	for {
+		line, err := d.readLine()
+		if err == io.EOF {
+			if buf.Len() == 0 {
+				return io.EOF
+			}
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if buf.Len() == 0 && isSeparator(line) {
+			d.seen = nil
+			start = d.line
+			continue
+		}
+		if buf.Len() == 0 && strings.TrimSpace(line) == "" {
+			start = d.line
+			continue
+		}
+		buf.WriteString(line)
+		scan.scan(line)
+		if scan.complete() {
+			break
+		}
+	}
+	n, err := parseAt(buf.Bytes(), start)
+	if err != nil {
+		return err
+	}
+	if n.kind != nodeBlock {
+		return &SyntaxError{
+			Col:  n.col,
+			Line: n.line,
+			Msg:  "expected a top-level entry, got " + n.describe(),
+		}
+	}
+	if len(n.calls) > 0 {
+		return callError(n.calls[0])
+	}
+	d.entries = n.entries
+	d.root = n
+	d.src = buf.String()
+	return nil
+}
+
+// readLine returns the next line from the stream, including its trailing
+// newline, if any. Errors are sticky, so that io.EOF is returned on every call
+// once the stream has been fully read.
+func (d *Decoder) readLine() (string, error) {
+	if d.err != nil {
+		return "", d.err
+	}
+	line, err := d.r.ReadString('\n')
+	if err != nil {
+		d.err = err
+		if line == "" {
+			return "", err
+		}
+	}
+	d.line++
+	return line, nil
+}
+
+// Encoder writes EON-encoded values to an output stream.
+type Encoder struct {
+	state int
+	w     io.Writer
+}
+
+// Encode writes the EON encoding of v to the stream as a document, followed
+// by a newline. Documents are separated by lines consisting of just ---, so
+// that they can be read back one at a time by a Decoder.
+//
+// The encoding is as per Marshal, except that the output is written to the
+// stream incrementally as it is generated, rather than being buffered in full.
+// On error, a partial document may have been written to the stream.
+func (e *Encoder) Encode(v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return ErrNilInterfaceValue
+	}
+	enc, err := getEncoder(rv.Type())
+	if err != nil {
+		return err
+	}
+	m := newMstate(nil)
+	m.w = e.w
+	if e.state != streamEmpty {
+		m.WriteString("---\n")
+	}
+	if err = enc(m, rv, OptToplevel); err == nil {
+		m.WriteByte('\n')
+		err = e.write(m)
+	}
+	mstates.Put(m)
+	e.state = streamDocument
+	return err
+}
+
+// EncodeEntry writes a top-level entry with the given key and the EON encoding
+// of v as its value to the stream, followed by a newline. Successive entries
+// form a single document, which can be read back one entry at a time by the
+// DecodeEntry method of a Decoder.
+func (e *Encoder) EncodeEntry(key string, v interface{}) error {
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return ErrNilInterfaceValue
+	}
+	enc, err := getEncoder(rv.Type())
+	if err != nil {
+		return err
+	}
+	m := newMstate(nil)
+	m.w = e.w
+	if e.state == streamDocument {
+		m.WriteString("---\n")
+	}
+	m.writeKey(key)
+	if isBlockValue(rv) {
+		m.WriteByte(' ')
+	} else {
+		m.WriteString(" = ")
+	}
+	if err = enc(m, rv, 0); err == nil {
+		m.WriteByte('\n')
+		err = e.write(m)
+	}
+	mstates.Put(m)
+	e.state = streamEntry
+	return err
+}
+
+// write writes out whatever output is still buffered within the given state,
+// and returns any error from writing to the stream.
+func (e *Encoder) write(m *mstate) error {
+	if m.err == nil && m.Len() > 0 {
+		_, m.err = e.w.Write(m.Bytes())
+	}
+	err := m.err
+	m.Reset()
+	m.w = nil
+	return err
+}
+
+// entryScanner tracks just enough of the lexical state of a source, as it's
+// fed in one line at a time, to tell whether it forms one or more complete
+// entries, i.e. whether it has no unterminated multiline strings or templates,
+// or unclosed brackets, and doesn't end with a key that is still waiting for
+// its value. Other lexical errors are ignored, so that they can be reported by
+// the parser once the line containing them has been read.
+type entryScanner struct {
+	depth     int
+	interps   []int
+	last      lex.TokenType
+	multiline bool
+}
+
+func (s *entryScanner) complete() bool {
+	switch s.last {
+	case 0, TokenAssign, TokenDot:
+		return false
+	}
+	return !s.multiline && len(s.interps) == 0 && s.depth <= 0
+}
+
+// scan updates the state with the given line. Like the lexer, the interps
+// field holds the number of open braces within each enclosing interpolation,
+// with -1 marking the text of a template string.
+func (s *entryScanner) scan(line string) {
+	i := 0
+	if s.multiline {
+		rest := strings.TrimLeft(line, " \t")
+		if !strings.HasPrefix(rest, `"""`) {
+			return
+		}
+		i = len(line) - len(rest) + 3
+		s.multiline = false
+	}
+	for i < len(line) {
+		if n := len(s.interps); n > 0 && s.interps[n-1] == -1 {
+			switch {
+			case strings.HasPrefix(line[i:], "${"):
+				s.interps = append(s.interps, 0)
+				i += 2
+			case line[i] == '`':
+				s.interps = s.interps[:n-1]
+				s.last = TokenTemplateEnd
+				i++
+			case line[i] == '\\':
+				i += 2
+			default:
+				i++
+			}
+			continue
+		}
+		r, size := utf8.DecodeRuneInString(line[i:])
+		switch {
+		case r == ' ' || r == '\t' || r == '\r' || r == '\n':
+		case strings.HasPrefix(line[i:], "//"):
+			return
+		case strings.HasPrefix(line[i:], `"""`):
+			s.last = TokenMultiline
+			s.multiline = true
+			return
+		case r == '"':
+			for size = 1; i+size < len(line); size++ {
+				if c := line[i+size]; c == '\\' {
+					size++
+				} else if c == '"' || c == '\n' {
+					break
+				}
+			}
+			size++
+			s.last = TokenString
+		case r == '`':
+			s.interps = append(s.interps, -1)
+			s.last = TokenTemplateStart
+		case r == '{' || r == '[' || r == '(':
+			if n := len(s.interps); n > 0 && r == '{' {
+				s.interps[n-1]++
+			} else if n == 0 {
+				s.depth++
+			}
+			s.last = TokenLBrace
+		case r == '}' || r == ']' || r == ')':
+			if n := len(s.interps); n > 0 && r == '}' {
+				if s.interps[n-1] == 0 {
+					s.interps = s.interps[:n-1]
+				} else {
+					s.interps[n-1]--
+				}
+			} else if n == 0 {
+				s.depth--
+			}
+			s.last = TokenRBrace
+		case r == '=':
+			s.last = TokenAssign
+		case r == '.':
+			s.last = TokenDot
+		case r == '-' || isDigit(r):
+			for i+size < len(line) {
+				r, n := utf8.DecodeRuneInString(line[i+size:])
+				if !isLiteralChar(r) {
+					break
+				}
+				size += n
+			}
+			s.last = TokenNumber
+		case isIdentStart(r):
+			for i+size < len(line) {
+				r, n := utf8.DecodeRuneInString(line[i+size:])
+				if !isIdentChar(r) {
+					break
+				}
+				size += n
+			}
+			s.last = TokenIdent
+		default:
+			s.last = TokenSeparator
+		}
+		i += size
+	}
+}
+
+// NewDecoder returns a new decoder that reads from r. The decoder buffers its
+// input, and may read data from r beyond the values that it has decoded.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: w}
+}
+
+func isSeparator(line string) bool {
+	return strings.TrimRight(line, "\r\n") == "---"
+}
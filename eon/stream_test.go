@@ -0,0 +1,323 @@
+package eon
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type countingWriter struct {
+	buf    bytes.Buffer
+	writes int
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.writes++
+	return c.buf.Write(p)
+}
+
+type streamPeer struct {
+	Addr string
+	Port int
+	Tags []string `eon:",inline"`
+}
+
+func TestDecoder(t *testing.T) {
+	src := `---
+addr = "10.0.0.1"
+port = 8080
+---
+// second peer
+addr = "10.0.0.2"
+port = 9090
+
+---
+`
+	dec := NewDecoder(strings.NewReader(src))
+	var peers []streamPeer
+	for {
+		var peer streamPeer
+		err := dec.Decode(&peer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error when decoding document: %s", err)
+		}
+		peers = append(peers, peer)
+	}
+	expect := []streamPeer{{Addr: "10.0.0.1", Port: 8080}, {Addr: "10.0.0.2", Port: 9090}}
+	if fmt.Sprint(peers) != fmt.Sprint(expect) {
+		t.Errorf("mismatching decoded documents: expected %v, got %v", expect, peers)
+	}
+	if err := dec.Decode(&streamPeer{}); err != io.EOF {
+		t.Errorf("expected io.EOF after the last document, got %v", err)
+	}
+	// Empty documents written by an Encoder should be read back as such.
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	docs := []map[string]int{{"a": 1}, {}, {"c": 3}}
+	for _, doc := range docs {
+		if err := enc.Encode(doc); err != nil {
+			t.Fatalf("unexpected error when encoding document: %s", err)
+		}
+	}
+	dec = NewDecoder(buf)
+	var got []map[string]int
+	for {
+		var doc map[string]int
+		err := dec.Decode(&doc)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error when decoding document: %s", err)
+		}
+		got = append(got, doc)
+	}
+	if fmt.Sprint(got) != fmt.Sprint(docs) {
+		t.Errorf("mismatching decoded documents with an empty one: expected %v, got %v", docs, got)
+	}
+}
+
+func TestDecoderEntries(t *testing.T) {
+	src := `// peers
+peer1 {
+	addr = "10.0.0.1"
+	port = 8080
+}
+
+peer2 = {addr = "10.0.0.2", port = 9090, tags = [
+	"relay"
+	"""
+	multi
+	"""
+]}
+---
+peer3 {
+	addr = ` + "`10.0.0.${port}`" + `
+	port = 3
+}
+peer4 {
+	// {[ brackets within comments are ignored
+	addr = "10.0.0.4" // as are those within "strings {"
+	port = 4
+	tags = [` + "`${addr}:${port}\n`" + ` "}"]
+}
+`
+	dec := NewDecoder(strings.NewReader(src))
+	var keys []string
+	var peers []streamPeer
+	for {
+		var peer streamPeer
+		key, err := dec.DecodeEntry(&peer)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("unexpected error when decoding entry: %s", err)
+		}
+		keys = append(keys, key)
+		peers = append(peers, peer)
+	}
+	if strings.Join(keys, " ") != "peer1 peer2 peer3 peer4" {
+		t.Errorf("mismatching entry keys: got %q", keys)
+	}
+	expect := []streamPeer{
+		{Addr: "10.0.0.1", Port: 8080},
+		{Addr: "10.0.0.2", Port: 9090, Tags: []string{"relay", "multi"}},
+		{Addr: "10.0.0.3", Port: 3},
+		{Addr: "10.0.0.4", Port: 4, Tags: []string{"10.0.0.4:4\n", "}"}},
+	}
+	if !reflect.DeepEqual(peers, expect) {
+		t.Errorf("mismatching decoded entries: expected %#v, got %#v", expect, peers)
+	}
+}
+
+func TestDecoderEntriesLarge(t *testing.T) {
+	var buf bytes.Buffer
+	buf.WriteString("peers = [\n")
+	for i := 0; i < 20000; i++ {
+		fmt.Fprintf(&buf, "\t{\n\t\taddr = \"10.0.%d.%d\"\n\t\tport = %d\n\t}\n", i/256, i%256, i)
+	}
+	buf.WriteString("]\ncount = 20000\n")
+	dec := NewDecoder(&buf)
+	var peers []streamPeer
+	key, err := dec.DecodeEntry(&peers)
+	if err != nil {
+		t.Fatalf("unexpected error when decoding large entry: %s", err)
+	}
+	if key != "peers" || len(peers) != 20000 || peers[19999].Port != 19999 {
+		t.Errorf("mismatching decoded large entry: got key %q with %d peers", key, len(peers))
+	}
+	var count int
+	if key, err = dec.DecodeEntry(&count); err != nil {
+		t.Fatalf("unexpected error when decoding entry after large entry: %s", err)
+	}
+	if key != "count" || count != 20000 {
+		t.Errorf("mismatching entry after large entry: got %s = %d", key, count)
+	}
+}
+
+func TestDecoderErrors(t *testing.T) {
+	type elem struct {
+		entries bool
+		src     string
+		want    string
+	}
+	for _, elem := range []elem{
+		{false, "a = 1\n---\na = \n", "eon: syntax error at line 4, col 1: unexpected end of input, expected value"},
+		{false, "a = 1\n---\n\na = \"x\n", "eon: syntax error at line 4, col 7: unterminated string literal"},
+		{false, "a = 1\n---\nb = 1\na = true\n", "eon: cannot decode bool into value of type int for key a at line 4, col 5"},
+		{true, "a = 1\n\na = true\n", "eon: cannot decode bool into value of type int for key a at line 3, col 5"},
+		{true, "a = 1\n---\na = [1, 2\n", "eon: syntax error at line 4, col 1: unexpected end of input, expected ']'"},
+		{true, "a = 1\n[1, 2]\n", "eon: syntax error at line 2, col 1: expected a top-level entry, got list"},
+		{true, "a = 1\nprint a\n", "eon: cannot call print outside of dynamic mode at line 2, col 1"},
+	} {
+		dec := NewDecoder(strings.NewReader(elem.src))
+		var err error
+		for err == nil {
+			if elem.entries {
+				var v int
+				_, err = dec.DecodeEntry(&v)
+			} else {
+				var v struct{ A int }
+				err = dec.Decode(&v)
+			}
+		}
+		if err == io.EOF {
+			t.Errorf("expected error when decoding %q, got io.EOF", elem.src)
+			continue
+		}
+		if err.Error() != elem.want {
+			t.Errorf("mismatching error when decoding %q: expected %q, got %q", elem.src, elem.want, err)
+		}
+	}
+}
+
+func TestDecoderStrict(t *testing.T) {
+	type peer struct {
+		Addr string
+		Port int `eon:",required"`
+	}
+	src := `addr = "10.0.0.1"
+prot = 8080
+---
+addr = "10.0.0.2"
+port = 9090
+addr = "10.0.0.3"
+opts {
+	a = 1
+	a = 2
+}
+`
+	dec := NewDecoder(strings.NewReader(src))
+	dec.DisallowDuplicateKeys()
+	dec.DisallowUnknownKeys()
+	type elem struct {
+		errs []string
+	}
+	for _, elem := range []elem{
+		{[]string{
+			"eon: missing required key port at line 1, col 1",
+			"eon: unknown key prot at line 2, col 1",
+		}},
+		{[]string{
+			"eon: duplicate key addr at line 6, col 1",
+			"eon: unknown key opts at line 7, col 1",
+			"eon: duplicate key opts.a at line 9, col 2",
+		}},
+	} {
+		var v peer
+		err := dec.Decode(&v)
+		errs, ok := err.(KeyErrors)
+		if !ok {
+			t.Fatalf("expected KeyErrors when decoding strictly, got %v", err)
+		}
+		var got []string
+		for _, err := range errs {
+			got = append(got, err.Error())
+		}
+		if !reflect.DeepEqual(got, elem.errs) {
+			t.Errorf("mismatching key errors: expected %q, got %q", elem.errs, got)
+		}
+	}
+	src = "a = 1\nb = 2\na = 3\n---\na = 4\n"
+	dec = NewDecoder(strings.NewReader(src))
+	dec.DisallowDuplicateKeys()
+	var errs []string
+	for {
+		var v int
+		_, err := dec.DecodeEntry(&v)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	expect := []string{"eon: duplicate key a at line 3, col 1"}
+	if !reflect.DeepEqual(errs, expect) {
+		t.Errorf("mismatching errors for duplicate entries: expected %q, got %q", expect, errs)
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	buf := &bytes.Buffer{}
+	enc := NewEncoder(buf)
+	if err := enc.Encode(streamPeer{Addr: "10.0.0.1", Port: 8080}); err != nil {
+		t.Fatalf("unexpected error when encoding document: %s", err)
+	}
+	if err := enc.Encode(map[string]int{"port": 9090}); err != nil {
+		t.Fatalf("unexpected error when encoding document: %s", err)
+	}
+	if err := enc.EncodeEntry("peer", streamPeer{Addr: "10.0.0.3", Tags: []string{"relay"}}); err != nil {
+		t.Fatalf("unexpected error when encoding entry: %s", err)
+	}
+	if err := enc.EncodeEntry("count", 3); err != nil {
+		t.Fatalf("unexpected error when encoding entry: %s", err)
+	}
+	expect := `addr = "10.0.0.1"
+port = 8080
+tags = []
+---
+port = 9090
+---
+peer {
+	addr = "10.0.0.3"
+	port = 0
+	tags = ["relay"]
+}
+count = 3
+`
+	if buf.String() != expect {
+		t.Errorf("mismatching encoder output: expected %q, got %q", expect, buf.String())
+	}
+	if err := enc.Encode(nil); err != ErrNilInterfaceValue {
+		t.Errorf("expected ErrNilInterfaceValue when encoding nil, got %v", err)
+	}
+}
+
+func TestEncoderStreaming(t *testing.T) {
+	peers := make([]streamPeer, 2000)
+	for i := range peers {
+		peers[i] = streamPeer{Addr: fmt.Sprintf("10.0.%d.%d", i/256, i%256), Port: i}
+	}
+	w := &countingWriter{}
+	if err := NewEncoder(w).Encode(struct{ Peers []streamPeer }{peers}); err != nil {
+		t.Fatalf("unexpected error when encoding peers: %s", err)
+	}
+	if w.writes < 2 {
+		t.Errorf("expected output to be written incrementally, got %d writes", w.writes)
+	}
+	var out struct{ Peers []streamPeer }
+	if err := NewDecoder(&w.buf).Decode(&out); err != nil {
+		t.Fatalf("unexpected error when decoding peers: %s", err)
+	}
+	if fmt.Sprint(out.Peers) != fmt.Sprint(peers) {
+		t.Errorf("mismatching decoded peers")
+	}
+}
@@ -0,0 +1,307 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package eon
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"peerbase.net/go/bytesize"
+	"peerbase.net/go/semver"
+)
+
+// Value kinds.
+const (
+	KindBinary Kind = iota + 1
+	KindBlock
+	KindBool
+	KindByteSize
+	KindDate
+	KindDuration
+	KindList
+	KindNull
+	KindNumber
+	KindString
+	KindTimestamp
+	KindVersion
+)
+
+var kindNames = map[Kind]string{
+	KindBinary:    "binary",
+	KindBlock:     "block",
+	KindBool:      "bool",
+	KindByteSize:  "byte size",
+	KindDate:      "date",
+	KindDuration:  "duration",
+	KindList:      "list",
+	KindNull:      "null",
+	KindNumber:    "number",
+	KindString:    "string",
+	KindTimestamp: "timestamp",
+	KindVersion:   "version",
+}
+
+// Kind represents the kind of an EON value.
+type Kind int
+
+func (k Kind) String() string {
+	if name, ok := kindNames[k]; ok {
+		return name
+	}
+	return "invalid"
+}
+
+// Value represents an evaluated EON value of any kind. Values are produced by
+// Eval, and their contents can be accessed with the accessor method for their
+// kind, e.g. Int for numbers. Accessors return an error if they are called on a
+// Value of a different kind.
+type Value struct {
+	col    int
+	elems  []*Value
+	key    string
+	keys   []string
+	kind   Kind
+	line   int
+	text   string
+	values map[string]*Value
+}
+
+// Bool returns the value of a bool.
+func (v *Value) Bool() (bool, error) {
+	if v.kind != KindBool {
+		return false, v.mismatch("bool")
+	}
+	return v.text == "true", nil
+}
+
+// ByteSize returns the value of a byte size.
+func (v *Value) ByteSize() (bytesize.Value, error) {
+	if v.kind != KindByteSize {
+		return 0, v.mismatch("byte size")
+	}
+	size, err := bytesize.Parse(v.text)
+	if err != nil {
+		return 0, v.errorf("invalid byte size %s", v.text)
+	}
+	return size, nil
+}
+
+// Bytes returns the value of a binary literal.
+func (v *Value) Bytes() ([]byte, error) {
+	if v.kind != KindBinary {
+		return nil, v.mismatch("binary")
+	}
+	return []byte(v.text), nil
+}
+
+// Col returns the column at which the value was defined in the source.
+func (v *Value) Col() int {
+	return v.col
+}
+
+// Date returns the value of a date.
+func (v *Value) Date() (Date, error) {
+	if v.kind != KindDate {
+		return Date{}, v.mismatch("date")
+	}
+	d, err := ParseDate(v.text)
+	if err != nil {
+		return Date{}, v.errorf("invalid date %s", v.text)
+	}
+	return d, nil
+}
+
+// Duration returns the value of a duration.
+func (v *Value) Duration() (time.Duration, error) {
+	if v.kind != KindDuration {
+		return 0, v.mismatch("duration")
+	}
+	d, err := time.ParseDuration(v.text)
+	if err != nil {
+		return 0, v.errorf("invalid duration %s", v.text)
+	}
+	return d, nil
+}
+
+// Float returns the value of a number as a float64.
+func (v *Value) Float() (float64, error) {
+	if v.kind != KindNumber {
+		return 0, v.mismatch("number")
+	}
+	f, err := strconv.ParseFloat(v.text, 64)
+	if err != nil {
+		return 0, v.errorf("invalid float64 value %s", v.text)
+	}
+	return f, nil
+}
+
+// Get returns the value of the given key within a block. It returns nil if
+// the value is not a block, or if the key is not present.
+func (v *Value) Get(key string) *Value {
+	if v.kind != KindBlock {
+		return nil
+	}
+	return v.values[key]
+}
+
+// Int returns the value of a number as an int64. It returns an error if the
+// number is not an integer or is out of range.
+func (v *Value) Int() (int64, error) {
+	if v.kind != KindNumber {
+		return 0, v.mismatch("number")
+	}
+	i, err := strconv.ParseInt(v.text, 10, 64)
+	if err != nil {
+		return 0, v.errorf("invalid int64 value %s", v.text)
+	}
+	return i, nil
+}
+
+// Interface returns the value as a Go value of the same type that Unmarshal
+// would use when decoding into an interface value, e.g. map[string]interface{}
+// for blocks. Versions, dates, and timestamps are returned as strings.
+func (v *Value) Interface() interface{} {
+	switch v.kind {
+	case KindBinary:
+		return []byte(v.text)
+	case KindBlock:
+		m := make(map[string]interface{}, len(v.keys))
+		for _, key := range v.keys {
+			m[key] = v.values[key].Interface()
+		}
+		return m
+	case KindBool:
+		return v.text == "true"
+	case KindByteSize:
+		size, _ := v.ByteSize()
+		return size
+	case KindDuration:
+		d, _ := v.Duration()
+		return d
+	case KindList:
+		l := make([]interface{}, len(v.elems))
+		for i, elem := range v.elems {
+			l[i] = elem.Interface()
+		}
+		return l
+	case KindNumber:
+		if i, err := v.Int(); err == nil {
+			return i
+		}
+		f, _ := v.Float()
+		return f
+	case KindDate, KindString, KindTimestamp, KindVersion:
+		return v.text
+	}
+	return nil
+}
+
+// Keys returns the keys of a block in the order that they were first defined.
+// It returns nil if the value is not a block.
+func (v *Value) Keys() []string {
+	if v.kind != KindBlock {
+		return nil
+	}
+	return v.keys
+}
+
+// Kind returns the kind of the value.
+func (v *Value) Kind() Kind {
+	return v.kind
+}
+
+// Len returns the number of elements in a list, or the number of keys in a
+// block. It returns zero for all other kinds.
+func (v *Value) Len() int {
+	switch v.kind {
+	case KindBlock:
+		return len(v.keys)
+	case KindList:
+		return len(v.elems)
+	}
+	return 0
+}
+
+// Line returns the line at which the value was defined in the source.
+func (v *Value) Line() int {
+	return v.line
+}
+
+// List returns the elements of a list.
+func (v *Value) List() ([]*Value, error) {
+	if v.kind != KindList {
+		return nil, v.mismatch("list")
+	}
+	return v.elems, nil
+}
+
+// Lookup returns the value at the given dotted path, e.g. author.name, within
+// nested blocks. It returns nil if any part of the path can't be found.
+func (v *Value) Lookup(path string) *Value {
+	for _, key := range strings.Split(path, ".") {
+		if v = v.Get(key); v == nil {
+			return nil
+		}
+	}
+	return v
+}
+
+// Text returns the value of a string. For the other literal kinds, i.e. bools,
+// byte sizes, dates, durations, numbers, timestamps, and versions, it returns
+// the literal as written in the source.
+func (v *Value) Text() (string, error) {
+	switch v.kind {
+	case KindBinary, KindBlock, KindList, KindNull:
+		return "", v.mismatch("text")
+	}
+	return v.text, nil
+}
+
+// Time returns the value of a timestamp, with the UTC offset that it was
+// written with. Dates are returned as midnight UTC on that day.
+func (v *Value) Time() (time.Time, error) {
+	switch v.kind {
+	case KindDate:
+		d, err := v.Date()
+		if err != nil {
+			return time.Time{}, err
+		}
+		return d.Time(time.UTC), nil
+	case KindTimestamp:
+		t, err := time.Parse(time.RFC3339Nano, v.text)
+		if err != nil {
+			return time.Time{}, v.errorf("invalid timestamp %s", v.text)
+		}
+		return t, nil
+	}
+	return time.Time{}, v.mismatch("timestamp")
+}
+
+// Version returns the value of a version.
+func (v *Value) Version() (semver.Version, error) {
+	if v.kind != KindVersion {
+		return semver.Version{}, v.mismatch("version")
+	}
+	ver, err := semver.Parse(v.text)
+	if err != nil {
+		return semver.Version{}, v.errorf("invalid version %s", v.text)
+	}
+	return ver, nil
+}
+
+// errorf returns a TypeError for the value, positioned where it was defined.
+func (v *Value) errorf(format string, args ...interface{}) error {
+	return &TypeError{
+		Col:  v.col,
+		Key:  v.key,
+		Line: v.line,
+		Msg:  fmt.Sprintf(format, args...),
+	}
+}
+
+func (v *Value) mismatch(expected string) error {
+	return v.errorf("cannot use %s value as %s", v.kind, expected)
+}
@@ -7,10 +7,221 @@
 // Go" talk: https://talks.golang.org/2011/lex.slide
 package lex
 
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
 // EOF is returned by certain methods of the lexing Engine to signal that it has
 // reached the end of the input.
 const EOF = -1
 
+// Engine holds the state of a lexical scanner. State functions use its methods
+// to consume the input rune by rune and to emit tokens and errors.
+//
+// Lines and columns are 1-based, with columns counted in runes. Positions are
+// 0-based byte offsets into the input.
+type Engine struct {
+	col       int
+	err       *Error
+	input     string
+	line      int
+	pos       int
+	prevCol   int
+	start     int
+	startCol  int
+	startLine int
+	state     StateFn
+	token     Token
+	tokens    []Token
+	width     int
+}
+
+// Accept consumes the next rune if it is contained in the given set of valid
+// runes.
+func (e *Engine) Accept(valid string) bool {
+	if strings.ContainsRune(valid, e.Next()) {
+		return true
+	}
+	e.Backup()
+	return false
+}
+
+// AcceptFunc consumes the next rune if it satisfies the given predicate.
+func (e *Engine) AcceptFunc(fn func(rune) bool) bool {
+	r := e.Next()
+	if r != EOF && fn(r) {
+		return true
+	}
+	e.Backup()
+	return false
+}
+
+// AcceptRun consumes a run of runes from the given set of valid runes and
+// returns the number of runes consumed.
+func (e *Engine) AcceptRun(valid string) int {
+	n := 0
+	for strings.ContainsRune(valid, e.Next()) {
+		n++
+	}
+	e.Backup()
+	return n
+}
+
+// AcceptRunFunc consumes a run of runes satisfying the given predicate and
+// returns the number of runes consumed.
+func (e *Engine) AcceptRunFunc(fn func(rune) bool) int {
+	n := 0
+	for e.AcceptFunc(fn) {
+		n++
+	}
+	return n
+}
+
+// Backup steps back over the last rune that was read by Next. It can only be
+// called once per call to Next.
+func (e *Engine) Backup() {
+	if e.width == 0 {
+		return
+	}
+	e.pos -= e.width
+	if e.input[e.pos] == '\n' {
+		e.line--
+		e.col = e.prevCol
+	} else {
+		e.col--
+	}
+	e.width = 0
+}
+
+// Emit passes a token of the given type back to the caller. The token value is
+// the input consumed since the last call to Emit or Ignore.
+func (e *Engine) Emit(typ TokenType) {
+	e.EmitValue(typ, e.input[e.start:e.pos])
+}
+
+// EmitValue is like Emit, but uses the given value for the emitted token instead
+// of the consumed input. This is useful when the token value has been
+// normalised by the state function, e.g. with escape sequences resolved.
+func (e *Engine) EmitValue(typ TokenType, value string) {
+	e.tokens = append(e.tokens, Token{
+		Col:   e.startCol,
+		Line:  e.startLine,
+		Pos:   e.start,
+		Type:  typ,
+		Value: value,
+	})
+	e.Ignore()
+}
+
+// Err returns the error that stopped the lexical scanning, if any. The returned
+// error, if not nil, is always an *Error value.
+func (e *Engine) Err() error {
+	if e.err == nil {
+		return nil
+	}
+	return e.err
+}
+
+// Errorf records an error of the given type at the current position and
+// returns a nil StateFn, which terminates the scanning. State functions should
+// Backup over any offending rune before calling Errorf so that the error
+// points at it.
+func (e *Engine) Errorf(typ ErrorType, format string, args ...interface{}) StateFn {
+	e.err = &Error{
+		Col:   e.col,
+		Line:  e.line,
+		Pos:   e.pos,
+		Type:  typ,
+		Value: fmt.Sprintf(format, args...),
+	}
+	return nil
+}
+
+// Ignore skips over the input consumed since the last call to Emit or Ignore.
+func (e *Engine) Ignore() {
+	e.start = e.pos
+	e.startCol = e.col
+	e.startLine = e.line
+}
+
+// Input returns the full input of the engine.
+func (e *Engine) Input() string {
+	return e.input
+}
+
+// Next consumes and returns the next rune of the input. It returns EOF when
+// there is no more input.
+func (e *Engine) Next() rune {
+	if e.pos >= len(e.input) {
+		e.width = 0
+		return EOF
+	}
+	r, width := utf8.DecodeRuneInString(e.input[e.pos:])
+	e.pos += width
+	e.width = width
+	if r == '\n' {
+		e.line++
+		e.prevCol = e.col
+		e.col = 1
+	} else {
+		e.col++
+	}
+	return r
+}
+
+// Peek returns the next rune of the input without consuming it.
+func (e *Engine) Peek() rune {
+	r := e.Next()
+	e.Backup()
+	return r
+}
+
+// Pending returns the input that has been consumed since the last call to Emit
+// or Ignore.
+func (e *Engine) Pending() string {
+	return e.input[e.start:e.pos]
+}
+
+// Pos returns the byte offset of the next rune to be read.
+func (e *Engine) Pos() int {
+	return e.pos
+}
+
+// Run drives the state functions until the scanning terminates and returns all
+// of the emitted tokens. If scanning stopped due to an error, the tokens emitted
+// before the error are returned together with the error.
+func (e *Engine) Run() ([]Token, error) {
+	var tokens []Token
+	for e.Scan() {
+		tokens = append(tokens, e.token)
+	}
+	return tokens, e.Err()
+}
+
+// Scan advances the engine to the next emitted token, which will then be
+// available through the Token method. State functions are only run as needed
+// to produce tokens. Scan returns false when the scanning terminates, either by
+// reaching the end of the input or by an error, which can be retrieved with
+// Err.
+func (e *Engine) Scan() bool {
+	for len(e.tokens) == 0 {
+		if e.state == nil {
+			return false
+		}
+		e.state = e.state(e)
+	}
+	e.token = e.tokens[0]
+	e.tokens = e.tokens[1:]
+	return true
+}
+
+// Token returns the most recent token produced by a call to Scan.
+func (e *Engine) Token() Token {
+	return e.token
+}
+
 // Error represents an emitted error.
 type Error struct {
 	Col   int
@@ -20,6 +231,10 @@ type Error struct {
 	Value string
 }
 
+func (e *Error) Error() string {
+	return fmt.Sprintf("lex: %s at line %d, col %d", e.Value, e.Line, e.Col)
+}
+
 // ErrorType represents the type of an emitted error.
 type ErrorType int
 
@@ -38,3 +253,16 @@ type Token struct {
 
 // TokenType represents the type of an emitted token.
 type TokenType int
+
+// New returns a lexing Engine that will scan the given input, starting with the
+// given state function.
+func New(input string, start StateFn) *Engine {
+	return &Engine{
+		col:       1,
+		input:     input,
+		line:      1,
+		startCol:  1,
+		startLine: 1,
+		state:     start,
+	}
+}
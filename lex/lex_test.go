@@ -0,0 +1,107 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package lex
+
+import (
+	"reflect"
+	"testing"
+	"unicode"
+)
+
+const (
+	tokenIdent TokenType = iota + 1
+	tokenNumber
+	tokenOp
+)
+
+const errUnexpected ErrorType = 1
+
+func lexAny(e *Engine) StateFn {
+	switch r := e.Peek(); {
+	case r == EOF:
+		return nil
+	case r == ' ' || r == '\n':
+		e.AcceptRun(" \n")
+		e.Ignore()
+	case unicode.IsLetter(r):
+		e.AcceptRunFunc(unicode.IsLetter)
+		e.Emit(tokenIdent)
+	case e.Accept("0123456789"):
+		e.AcceptRun("0123456789")
+		if e.Accept(".") {
+			e.AcceptRun("0123456789")
+		}
+		e.Emit(tokenNumber)
+	case e.Accept("+-*/="):
+		e.Emit(tokenOp)
+	default:
+		return e.Errorf(errUnexpected, "unexpected character %q", r)
+	}
+	return lexAny
+}
+
+func TestEngine(t *testing.T) {
+	e := New("x = 3.14\n  héllo*2", lexAny)
+	tokens, err := e.Run()
+	if err != nil {
+		t.Fatalf("unexpected error: %s", err)
+	}
+	expect := []Token{
+		{Col: 1, Line: 1, Pos: 0, Type: tokenIdent, Value: "x"},
+		{Col: 3, Line: 1, Pos: 2, Type: tokenOp, Value: "="},
+		{Col: 5, Line: 1, Pos: 4, Type: tokenNumber, Value: "3.14"},
+		{Col: 3, Line: 2, Pos: 11, Type: tokenIdent, Value: "héllo"},
+		{Col: 8, Line: 2, Pos: 17, Type: tokenOp, Value: "*"},
+		{Col: 9, Line: 2, Pos: 18, Type: tokenNumber, Value: "2"},
+	}
+	if !reflect.DeepEqual(expect, tokens) {
+		t.Errorf("mismatching tokens: expected %+v, got %+v", expect, tokens)
+	}
+}
+
+func TestEngineBackup(t *testing.T) {
+	e := New("a\nb", nil)
+	e.Next()
+	e.Next()
+	e.Backup()
+	if e.line != 1 || e.col != 2 || e.Pos() != 1 {
+		t.Errorf("unexpected position after backing up over newline: line %d, col %d, pos %d", e.line, e.col, e.Pos())
+	}
+	if r := e.Peek(); r != '\n' {
+		t.Errorf("unexpected rune from Peek: expected %q, got %q", '\n', r)
+	}
+	e.Next()
+	if r := e.Next(); r != 'b' {
+		t.Errorf("unexpected rune from Next: expected %q, got %q", 'b', r)
+	}
+	if r := e.Next(); r != EOF {
+		t.Errorf("expected EOF at end of input, got %q", r)
+	}
+	e.Backup()
+	if e.Pos() != 3 {
+		t.Errorf("Backup after EOF should be a no-op, got pos %d", e.Pos())
+	}
+}
+
+func TestEngineError(t *testing.T) {
+	e := New("x = 1\ny ? 2", lexAny)
+	var tokens []Token
+	for e.Scan() {
+		tokens = append(tokens, e.Token())
+	}
+	if len(tokens) != 4 {
+		t.Errorf("expected 4 tokens before the error, got %d", len(tokens))
+	}
+	err, ok := e.Err().(*Error)
+	if !ok {
+		t.Fatalf("expected an *Error value, got %v", e.Err())
+	}
+	expect := &Error{Col: 3, Line: 2, Pos: 8, Type: errUnexpected, Value: "unexpected character '?'"}
+	if !reflect.DeepEqual(expect, err) {
+		t.Errorf("mismatching error: expected %+v, got %+v", expect, err)
+	}
+	if msg := err.Error(); msg != "lex: unexpected character '?' at line 2, col 3" {
+		t.Errorf("mismatching error message: got %q", msg)
+	}
+}
@@ -0,0 +1,207 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+// Package semver provides support for semantic version values, as defined by
+// the Semantic Versioning 2.0.0 specification at https://semver.org.
+package semver
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// Version represents a semantic version, e.g. 1.4.2-beta.1+build.7. The
+// Prerelease and Build fields hold the dot-separated identifiers that follow
+// the - and + signs respectively, without the signs themselves.
+type Version struct {
+	Major      uint64
+	Minor      uint64
+	Patch      uint64
+	Prerelease string
+	Build      string
+}
+
+// Compare returns -1, 0, or +1 depending on whether v has lower, equal, or
+// higher precedence than the other version. As per the specification, build
+// metadata is ignored, and a pre-release version has lower precedence than the
+// associated normal version.
+func (v Version) Compare(other Version) int {
+	switch {
+	case v.Major != other.Major:
+		return compareUint(v.Major, other.Major)
+	case v.Minor != other.Minor:
+		return compareUint(v.Minor, other.Minor)
+	case v.Patch != other.Patch:
+		return compareUint(v.Patch, other.Patch)
+	case v.Prerelease == other.Prerelease:
+		return 0
+	case v.Prerelease == "":
+		return 1
+	case other.Prerelease == "":
+		return -1
+	}
+	a := strings.Split(v.Prerelease, ".")
+	b := strings.Split(other.Prerelease, ".")
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compareIdent(a[i], b[i]); c != 0 {
+			return c
+		}
+	}
+	return compareUint(uint64(len(a)), uint64(len(b)))
+}
+
+// Equal returns whether v has the same precedence as the other version, i.e.
+// whether they are equal when build metadata is ignored.
+func (v Version) Equal(other Version) bool {
+	return v.Compare(other) == 0
+}
+
+// Less returns whether v has lower precedence than the other version.
+func (v Version) Less(other Version) bool {
+	return v.Compare(other) < 0
+}
+
+// String returns the version in its canonical form, e.g. 1.4.2-beta.1+build.7.
+func (v Version) String() string {
+	s := strconv.FormatUint(v.Major, 10) + "." + strconv.FormatUint(v.Minor, 10) + "." + strconv.FormatUint(v.Patch, 10)
+	if v.Prerelease != "" {
+		s += "-" + v.Prerelease
+	}
+	if v.Build != "" {
+		s += "+" + v.Build
+	}
+	return s
+}
+
+// Validate checks that the pre-release and build identifiers are valid. The
+// identifiers must be non-empty and only contain ASCII alphanumerics and
+// hyphens, and numeric pre-release identifiers must not have leading zeros.
+func (v Version) Validate() error {
+	if v.Prerelease != "" {
+		for _, ident := range strings.Split(v.Prerelease, ".") {
+			if err := validateIdent(ident, true); err != nil {
+				return fmt.Errorf("semver: invalid pre-release %q: %s", v.Prerelease, err)
+			}
+		}
+	}
+	if v.Build != "" {
+		for _, ident := range strings.Split(v.Build, ".") {
+			if err := validateIdent(ident, false); err != nil {
+				return fmt.Errorf("semver: invalid build metadata %q: %s", v.Build, err)
+			}
+		}
+	}
+	return nil
+}
+
+// MustParse is like Parse but panics if the version cannot be parsed. It is
+// intended for use in variable initializations.
+func MustParse(s string) Version {
+	v, err := Parse(s)
+	if err != nil {
+		panic(err)
+	}
+	return v
+}
+
+// Parse tries to parse a semantic version from the given string, e.g.
+// "0.0.1", "1.4.2-beta.1", or "2.0.0+build.7". A leading "v" is not accepted.
+func Parse(s string) (Version, error) {
+	var v Version
+	rest := s
+	if i := strings.IndexByte(rest, '+'); i >= 0 {
+		v.Build = rest[i+1:]
+		if v.Build == "" {
+			return Version{}, fmt.Errorf("semver: invalid version %q: empty build metadata", s)
+		}
+		rest = rest[:i]
+	}
+	if i := strings.IndexByte(rest, '-'); i >= 0 {
+		v.Prerelease = rest[i+1:]
+		if v.Prerelease == "" {
+			return Version{}, fmt.Errorf("semver: invalid version %q: empty pre-release", s)
+		}
+		rest = rest[:i]
+	}
+	parts := strings.Split(rest, ".")
+	if len(parts) != 3 {
+		return Version{}, fmt.Errorf("semver: invalid version %q: expected major.minor.patch", s)
+	}
+	for i, dst := range []*uint64{&v.Major, &v.Minor, &v.Patch} {
+		part := parts[i]
+		if !isNumeric(part) {
+			return Version{}, fmt.Errorf("semver: invalid version %q: non-numeric component %q", s, part)
+		}
+		if len(part) > 1 && part[0] == '0' {
+			return Version{}, fmt.Errorf("semver: invalid version %q: leading zero in component %q", s, part)
+		}
+		n, err := strconv.ParseUint(part, 10, 64)
+		if err != nil {
+			return Version{}, fmt.Errorf("semver: invalid version %q: component %q overflows uint64", s, part)
+		}
+		*dst = n
+	}
+	if err := v.Validate(); err != nil {
+		return Version{}, err
+	}
+	return v, nil
+}
+
+// compareIdent compares two pre-release identifiers. Numeric identifiers are
+// compared numerically, and have lower precedence than alphanumeric ones,
+// which are compared lexically in ASCII sort order.
+func compareIdent(a, b string) int {
+	an, bn := isNumeric(a), isNumeric(b)
+	switch {
+	case an && bn:
+		if len(a) != len(b) {
+			return compareUint(uint64(len(a)), uint64(len(b)))
+		}
+		return strings.Compare(a, b)
+	case an:
+		return -1
+	case bn:
+		return 1
+	}
+	return strings.Compare(a, b)
+}
+
+func compareUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func isNumeric(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < '0' || s[i] > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+func validateIdent(ident string, prerelease bool) error {
+	if ident == "" {
+		return errors.New("empty identifier")
+	}
+	for i := 0; i < len(ident); i++ {
+		c := ident[i]
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '-') {
+			return fmt.Errorf("invalid character %q in identifier %q", c, ident)
+		}
+	}
+	if prerelease && len(ident) > 1 && ident[0] == '0' && isNumeric(ident) {
+		return fmt.Errorf("leading zero in numeric identifier %q", ident)
+	}
+	return nil
+}
@@ -0,0 +1,97 @@
+// Public Domain (-) 2018-present, The Peerbase Authors.
+// See the Peerbase UNLICENSE file for details.
+
+package semver
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCompare(t *testing.T) {
+	// Versions in increasing order of precedence, as per the example in the
+	// specification.
+	ordered := []string{
+		"1.0.0-alpha",
+		"1.0.0-alpha.1",
+		"1.0.0-alpha.beta",
+		"1.0.0-beta",
+		"1.0.0-beta.2",
+		"1.0.0-beta.11",
+		"1.0.0-rc.1",
+		"1.0.0",
+		"1.0.1",
+		"1.2.0",
+		"1.10.0",
+		"2.0.0",
+	}
+	for i, a := range ordered {
+		for j, b := range ordered {
+			expect := compareUint(uint64(i), uint64(j))
+			if got := MustParse(a).Compare(MustParse(b)); got != expect {
+				t.Errorf("mismatching comparison of %s and %s: expected %d, got %d", a, b, expect, got)
+			}
+		}
+	}
+	a, b := MustParse("1.0.0+build.1"), MustParse("1.0.0+build.2")
+	if !a.Equal(b) || a.Less(b) || b.Less(a) {
+		t.Errorf("build metadata was not ignored when comparing %s and %s", a, b)
+	}
+}
+
+func TestParse(t *testing.T) {
+	type elem struct {
+		v      string
+		expect Version
+	}
+	for _, elem := range []elem{
+		{"0.0.1", Version{Patch: 1}},
+		{"1.4.2", Version{Major: 1, Minor: 4, Patch: 2}},
+		{"1.0.0-beta.1", Version{Major: 1, Prerelease: "beta.1"}},
+		{"1.0.0-x-y.0", Version{Major: 1, Prerelease: "x-y.0"}},
+		{"2.0.0+build.007", Version{Major: 2, Build: "build.007"}},
+		{"1.0.0-rc.1+sha.5114f85", Version{Major: 1, Prerelease: "rc.1", Build: "sha.5114f85"}},
+		{"18446744073709551615.0.0", Version{Major: 18446744073709551615}},
+	} {
+		v, err := Parse(elem.v)
+		if err != nil {
+			t.Errorf("unexpected error when parsing %q: %s", elem.v, err)
+			continue
+		}
+		if v != elem.expect {
+			t.Errorf("mismatching version for %q: expected %#v, got %#v", elem.v, elem.expect, v)
+		}
+		if s := v.String(); s != elem.v {
+			t.Errorf("mismatching string value: expected %q, got %q", elem.v, s)
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	type elem struct {
+		v      string
+		expect string
+	}
+	for _, elem := range []elem{
+		{"1.0", "expected major.minor.patch"},
+		{"1.0.0.0", "expected major.minor.patch"},
+		{"v1.0.0", `non-numeric component "v1"`},
+		{"1..0", `non-numeric component ""`},
+		{"01.0.0", `leading zero in component "01"`},
+		{"1.0.0-", "empty pre-release"},
+		{"1.0.0+", "empty build metadata"},
+		{"1.0.0-alpha..1", "empty identifier"},
+		{"1.0.0-01", `leading zero in numeric identifier "01"`},
+		{"1.0.0-al_pha", `invalid character '_' in identifier "al_pha"`},
+		{"18446744073709551616.0.0", "overflows uint64"},
+	} {
+		_, err := Parse(elem.v)
+		if err == nil {
+			t.Errorf("failed to receive expected error when parsing %q", elem.v)
+			continue
+		}
+		if !strings.Contains(err.Error(), elem.expect) {
+			t.Errorf("mismatching error when parsing %q: expected %q, got %q", elem.v, elem.expect, err)
+		}
+	}
+}